@@ -4,7 +4,9 @@ go 1.13
 
 require (
 	github.com/bmatcuk/doublestar v1.3.0
-	github.com/go-git/go-billy/v5 v5.0.0
 	github.com/go-git/go-git/v5 v5.0.0
+	golang.org/x/crypto v0.0.0-20200302210943-78000ba7a073
 	golang.org/x/mod v0.2.0
+	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	gopkg.in/yaml.v2 v2.2.4
 )
@@ -0,0 +1,289 @@
+package stencil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// GitCredentials provides credentials for git remotes.  Auth returns
+// nil if there are no credentials for the remote.
+type GitCredentials interface {
+	Name() string
+	Auth(remote string) (transport.AuthMethod, error)
+}
+
+// DefaultCredentials returns the credentials used when FS.Credentials
+// is not set:
+//
+//	STENCIL_GIT_TOKEN (with STENCIL_GIT_USERNAME) for https remotes
+//	  on the hosts in STENCIL_GIT_TOKEN_HOST
+//	~/.netrc (or $NETRC) for https remotes
+//	git credential fill for https remotes
+//	STENCIL_SSH_KEY (with STENCIL_SSH_KEY_PASSPHRASE) for ssh remotes
+//
+// Remotes are also tried without any credentials, which uses the SSH
+// agent for ssh remotes.
+func DefaultCredentials() []GitCredentials {
+	netrc := os.Getenv("NETRC")
+	if home, err := os.UserHomeDir(); err == nil && netrc == "" {
+		netrc = filepath.Join(home, ".netrc")
+	}
+
+	return []GitCredentials{
+		&TokenCredentials{Env: "STENCIL_GIT_TOKEN", UsernameEnv: "STENCIL_GIT_USERNAME", HostEnv: "STENCIL_GIT_TOKEN_HOST"},
+		&NetrcCredentials{Path: netrc},
+		&HelperCredentials{Command: []string{"git", "credential", "fill"}},
+		&SSHKeyCredentials{Env: "STENCIL_SSH_KEY", PassphraseEnv: "STENCIL_SSH_KEY_PASSPHRASE"},
+	}
+}
+
+// TokenCredentials uses a token from an environment variable as the
+// password for https remotes.  The token is only sent to the comma
+// separated hosts in the HostEnv environment variable, like netrc
+// entries are only used for their machine, so that it does not leak
+// to other hosts recipes are read from.
+type TokenCredentials struct {
+	Env, UsernameEnv, HostEnv string
+}
+
+// Name returns the name of the credentials used in errors.
+func (t *TokenCredentials) Name() string {
+	return "token from $" + t.Env
+}
+
+// Auth returns the credentials for the remote.
+func (t *TokenCredentials) Auth(remote string) (transport.AuthMethod, error) {
+	token := os.Getenv(t.Env)
+	if token == "" || !isHTTP(remote) {
+		return nil, nil
+	}
+
+	matched := false
+	for _, host := range strings.Split(os.Getenv(t.HostEnv), ",") {
+		host = strings.TrimSpace(host)
+		matched = matched || host != "" && host == hostOf(remote)
+	}
+	if !matched {
+		return nil, nil
+	}
+
+	username := os.Getenv(t.UsernameEnv)
+	if username == "" {
+		username = "stencil"
+	}
+	return &http.BasicAuth{Username: username, Password: token}, nil
+}
+
+// NetrcCredentials uses the login and password of the matching
+// machine in a netrc file for https remotes.
+type NetrcCredentials struct {
+	Path string
+}
+
+// Name returns the name of the credentials used in errors.
+func (n *NetrcCredentials) Name() string {
+	return "netrc " + n.Path
+}
+
+// Auth returns the credentials for the remote.
+func (n *NetrcCredentials) Auth(remote string) (transport.AuthMethod, error) {
+	if n.Path == "" || !isHTTP(remote) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(n.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	host := hostOf(remote)
+	var machine, login, password string
+	found := false
+	fields := strings.Fields(string(data))
+	for kk := 0; kk < len(fields); kk++ {
+		next := func() string {
+			if kk+1 < len(fields) {
+				kk++
+				return fields[kk]
+			}
+			return ""
+		}
+
+		switch fields[kk] {
+		case "machine", "default":
+			if found {
+				return &http.BasicAuth{Username: login, Password: password}, nil
+			}
+			machine, login, password = "", "", ""
+			if fields[kk] == "machine" {
+				machine = next()
+			}
+			found = fields[kk] == "default" || machine == host
+		case "login":
+			login = next()
+		case "password":
+			password = next()
+		}
+	}
+
+	if found {
+		return &http.BasicAuth{Username: login, Password: password}, nil
+	}
+	return nil, nil
+}
+
+// HelperCredentials asks an external program for the credentials of
+// https remotes using the git credential protocol.  The command is
+// run with the protocol, host and path of the remote on stdin and it
+// must print the username and password to stdout, like
+// "git credential fill" does.
+type HelperCredentials struct {
+	Command []string
+}
+
+// Name returns the name of the credentials used in errors.
+func (h *HelperCredentials) Name() string {
+	return "credential helper " + strings.Join(h.Command, " ")
+}
+
+// Auth returns the credentials for the remote.
+func (h *HelperCredentials) Auth(remote string) (transport.AuthMethod, error) {
+	if len(h.Command) == 0 || !isHTTP(remote) {
+		return nil, nil
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	var input bytes.Buffer
+	input.WriteString("protocol=" + u.Scheme + "\n")
+	input.WriteString("host=" + u.Host + "\n")
+	input.WriteString("path=" + strings.TrimPrefix(u.Path, "/") + "\n\n")
+
+	cmd := exec.Command(h.Command[0], h.Command[1:]...) //nolint: gosec
+	cmd.Stdin = &input
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &http.BasicAuth{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		switch {
+		case len(parts) != 2:
+		case parts[0] == "username":
+			auth.Username = parts[1]
+		case parts[0] == "password":
+			auth.Password = parts[1]
+		}
+	}
+	if auth.Password == "" {
+		return nil, nil
+	}
+	return auth, scanner.Err()
+}
+
+// SSHKeyCredentials uses the private key file named by an
+// environment variable for ssh remotes.
+type SSHKeyCredentials struct {
+	Env, PassphraseEnv string
+}
+
+// Name returns the name of the credentials used in errors.
+func (s *SSHKeyCredentials) Name() string {
+	return "ssh key from $" + s.Env
+}
+
+// Auth returns the credentials for the remote.
+func (s *SSHKeyCredentials) Auth(remote string) (transport.AuthMethod, error) {
+	path := os.Getenv(s.Env)
+	if path == "" || isHTTP(remote) || isLocal(remote) {
+		return nil, nil
+	}
+
+	user := gitssh.DefaultUsername
+	if u, err := url.Parse(remote); err == nil && u.User != nil {
+		user = u.User.Username()
+	} else if idx := strings.Index(remote, "@"); idx >= 0 {
+		user = remote[:idx]
+	}
+	return gitssh.NewPublicKeysFromFile(user, path, os.Getenv(s.PassphraseEnv))
+}
+
+// withAuth calls fn with every applicable credential for the remote
+// (and finally without any credentials) until one of them succeeds.
+// If all of them fail to authenticate, the error lists the methods
+// that were tried.
+func (fs *FS) withAuth(remote string, fn func(auth transport.AuthMethod) error) error {
+	creds := fs.Credentials
+	if creds == nil {
+		creds = DefaultCredentials()
+	}
+
+	tried := []string{}
+	for _, c := range creds {
+		auth, err := c.Auth(remote)
+		if err != nil {
+			tried = append(tried, c.Name()+": "+err.Error())
+			continue
+		}
+		if auth == nil {
+			continue
+		}
+
+		err = fn(auth)
+		if !isAuthError(err) {
+			return err
+		}
+		tried = append(tried, c.Name()+": "+err.Error())
+	}
+
+	err := fn(nil)
+	if !isAuthError(err) || isLocal(remote) {
+		return err
+	}
+	tried = append(tried, "no credentials: "+err.Error())
+	return errors.New("git authentication failed for " + remote + ", tried " + strings.Join(tried, "; "))
+}
+
+func isAuthError(err error) bool {
+	return err == transport.ErrAuthenticationRequired ||
+		err == transport.ErrAuthorizationFailed ||
+		err == transport.ErrRepositoryNotFound ||
+		err != nil && strings.Contains(err.Error(), "unable to authenticate")
+}
+
+func isHTTP(remote string) bool {
+	return strings.HasPrefix(remote, "https://") || strings.HasPrefix(remote, "http://")
+}
+
+func isLocal(remote string) bool {
+	return strings.HasPrefix(remote, "file://") || filepath.IsAbs(remote)
+}
+
+func hostOf(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
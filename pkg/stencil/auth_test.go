@@ -0,0 +1,107 @@
+package stencil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestGitAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := newGitRepo(t, filepath.Join(dir, "repo.git"))
+	repo.commit("f.txt", "hello")
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Fatal("git", err)
+	}
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, password, _ := r.BasicAuth(); password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	netrc := filepath.Join(dir, "netrc")
+	data := "machine example.com login x password y\nmachine 127.0.0.1 login u password secret\n"
+	if err := ioutil.WriteFile(netrc, []byte(data), 0600); err != nil {
+		t.Fatal("WriteFile", err)
+	}
+	os.Setenv("STENCIL_TEST_TOKEN", "secret")
+	os.Setenv("STENCIL_TEST_TOKEN_HOST", "example.com, 127.0.0.1")
+	defer os.Unsetenv("STENCIL_TEST_TOKEN")
+	defer os.Unsetenv("STENCIL_TEST_TOKEN_HOST")
+
+	cases := map[string]stencil.GitCredentials{
+		"token":  &stencil.TokenCredentials{Env: "STENCIL_TEST_TOKEN", HostEnv: "STENCIL_TEST_TOKEN_HOST"},
+		"netrc":  &stencil.NetrcCredentials{Path: netrc},
+		"helper": &stencil.HelperCredentials{Command: []string{"sh", "-c", "echo username=u; echo password=secret"}},
+	}
+	discard := discardLogger{}
+	for name, creds := range cases {
+		fs := &stencil.FS{
+			CacheDir:    filepath.Join(dir, "cache-"+name),
+			Credentials: []stencil.GitCredentials{creds},
+			Verbose:     discard,
+			Errorl:      discard,
+		}
+		data, err := fs.Read("git:" + srv.URL + "/repo.git/f.txt")
+		if err != nil || string(data) != "hello" {
+			t.Errorf("%s: got %q %v", name, data, err)
+		}
+	}
+
+	fs := &stencil.FS{
+		CacheDir:    filepath.Join(dir, "cache-none"),
+		Credentials: []stencil.GitCredentials{&stencil.TokenCredentials{Env: "STENCIL_TEST_MISSING"}},
+		Verbose:     discard,
+		Errorl:      discard,
+	}
+	_, err = fs.Read("git:" + srv.URL + "/repo.git/f.txt")
+	if err == nil || !strings.Contains(err.Error(), "tried no credentials") {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestTokenCredentialsHosts(t *testing.T) {
+	os.Setenv("STENCIL_TEST_TOKEN", "secret")
+	os.Setenv("STENCIL_TEST_TOKEN_HOST", "git.example.com")
+	defer os.Unsetenv("STENCIL_TEST_TOKEN")
+	defer os.Unsetenv("STENCIL_TEST_TOKEN_HOST")
+
+	creds := &stencil.TokenCredentials{Env: "STENCIL_TEST_TOKEN", HostEnv: "STENCIL_TEST_TOKEN_HOST"}
+	if auth, err := creds.Auth("https://git.example.com/a/b.git"); err != nil || auth == nil {
+		t.Error("Missing auth", auth, err)
+	}
+	for _, remote := range []string{"https://github.com/a/b.git", "https://example.com/a/b.git", "https://git.example.com.evil.io/a/b.git"} {
+		if auth, err := creds.Auth(remote); err != nil || auth != nil {
+			t.Error("Unexpected auth for", remote, auth, err)
+		}
+	}
+
+	os.Unsetenv("STENCIL_TEST_TOKEN_HOST")
+	if auth, err := creds.Auth("https://git.example.com/a/b.git"); err != nil || auth != nil {
+		t.Error("Unexpected auth without hosts", auth, err)
+	}
+}
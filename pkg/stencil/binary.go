@@ -19,6 +19,13 @@ const tlsTimeout = time.Second * 5
 const httpTimeout = time.Second * 30
 const targz = ".tar.gz"
 
+// downloader is implemented by file systems which record downloads,
+// such as Plan.  Download returns false if the download should be
+// skipped.
+type downloader interface {
+	Download(url, path string) bool
+}
+
 // Binary implements managing binaries.
 type Binary struct {
 	*Stencil
@@ -26,20 +33,30 @@ type Binary struct {
 
 // CopyFromArchive copies a file from an archive at the url.
 // CopyFromArchive supports .tar, .tar.gz and .zip extensions for the archive.
+// The archive is not downloaded again if the file extracted by the
+// previous run is unchanged.
 func (b *Binary) CopyFromArchive(key, destination, url, file string) error {
 	if b.Objects.existsArchiveFile(key, destination, url, file) {
 		return nil
 	}
-	b.Objects.addArchiveFile(key, destination, url, file)
+	obj := b.Objects.addArchiveFile(key, destination, url, file)
+	if b.Objects.unchangedArchive(key, obj) {
+		return nil
+	}
+	if d, ok := b.FileSystem.(downloader); ok && !d.Download(url, destination) {
+		return nil
+	}
+
 	seen := false
 	err := b.extract(url, func(fname string, r func() io.ReadCloser) error {
 		if !strings.EqualFold(file, fname) {
 			return nil
 		}
 
+		seen = true
 		src := r()
 		defer src.Close()
-		return b.copy(key+fname, destination, src)
+		return b.copy(obj, destination, src)
 	})
 	if err == nil && !seen {
 		err = errors.New("no such file: " + file)
@@ -57,7 +74,14 @@ func (b *Binary) CopyManyFromArchive(key, destination, url, glob string) error {
 	if b.Objects.existsArchiveGlob(key, destination, url, glob) {
 		return nil
 	}
-	b.Objects.addArchiveGlob(key, destination, url, glob)
+	obj := b.Objects.addArchiveGlob(key, destination, url, glob)
+	if b.Objects.unchangedArchive(key, obj) {
+		return nil
+	}
+	if d, ok := b.FileSystem.(downloader); ok && !d.Download(url, destination) {
+		return nil
+	}
+
 	return b.extract(url, func(fname string, r func() io.ReadCloser) error {
 		if match, err := doublestar.Match(glob, fname); err != nil || !match {
 			return err
@@ -65,19 +89,23 @@ func (b *Binary) CopyManyFromArchive(key, destination, url, glob string) error {
 
 		src := r()
 		defer src.Close()
-		return b.copy(key+fname, filepath.Join(destination, fname), src)
+		return b.copy(obj, filepath.Join(destination, fname), src)
 	})
 }
 
-func (b *Binary) extract(url string, visit func(name string, r func() io.ReadCloser) error) error {
-	client := &http.Client{
+// httpClient returns the client used for all http requests.
+func httpClient() *http.Client {
+	return &http.Client{
 		Timeout: httpTimeout,
 		Transport: &http.Transport{
 			Dial:                (&net.Dialer{Timeout: dialTimeout}).Dial,
 			TLSHandshakeTimeout: tlsTimeout,
 		},
 	}
-	resp, err := client.Get(url)
+}
+
+func (b *Binary) extract(url string, visit func(name string, r func() io.ReadCloser) error) error {
+	resp, err := httpClient().Get(url)
 	if err != nil {
 		return err
 	}
@@ -117,11 +145,11 @@ func (b *Binary) guessExtension(contentType, url string) string {
 	return filepath.Ext(url)
 }
 
-func (b *Binary) copy(key, dest string, src io.Reader) error {
-	_ = key
+func (b *Binary) copy(obj *FileArchiveObj, dest string, src io.Reader) error {
 	data, err := ioutil.ReadAll(src)
 	if err != nil {
 		return err
 	}
+	obj.Digests[filepath.Clean(dest)] = Digest(data)
 	return b.Write(dest, data, 0766)
 }
@@ -0,0 +1,168 @@
+package stencil
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Errors returned by Check.
+var (
+	ErrOutOfDate  = errors.New("workspace is out of date")
+	ErrUnanswered = errors.New("variables have no saved value")
+)
+
+// Exit codes for the errors returned by Check.
+const (
+	ExitOutOfDate  = 2
+	ExitUnanswered = 3
+	ExitDrift      = 4
+)
+
+// ExitCode returns the process exit code for an error returned by
+// Main.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrUnanswered):
+		return ExitUnanswered
+	case errors.Is(err, ErrDrift):
+		return ExitDrift
+	case errors.Is(err, ErrOutOfDate):
+		return ExitOutOfDate
+	}
+	return 1
+}
+
+// Check re-runs all the pulls without prompting and without making
+// any changes.  It returns ErrUnanswered if any variable does not
+// have a saved value or a default, ErrDrift if any managed file was modified
+// locally or has unresolved conflicts and ErrOutOfDate if a sync would change the workspace or
+// objects.json.
+func (s *Stencil) Check() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	statuses, err := s.fileStatuses(s.Before)
+	if err != nil {
+		return s.Errorf("check %v\n", err)
+	}
+
+	plan := NewPlan(s.FileSystem)
+	prompter := s.Prompter
+	s.FileSystem, s.Prompter = plan, noPrompt{defaults: true}
+	defer func() { s.FileSystem, s.Prompter = plan.FileSystem, prompter }()
+
+	if err := s.applyLoaded("", ""); err != nil {
+		return err
+	}
+
+	unanswered := s.unanswered()
+	for _, name := range unanswered {
+		s.Printf("unanswered: %s\n", name)
+	}
+
+	drift := false
+	for _, st := range statuses {
+		if st.Status != StatusClean {
+			s.Printf("%s: %s\n", st.Status, st.Path)
+			drift = true
+		}
+	}
+	conflicts := []string{}
+	for path := range s.Before.Conflicts {
+		conflicts = append(conflicts, path)
+	}
+	sort.Strings(conflicts)
+	for _, path := range conflicts {
+		s.Printf("conflict: %s\n", path)
+		drift = true
+	}
+
+	for _, c := range plan.Changes {
+		s.Printf("out of date: %s %s\n", c.Op, c.Path)
+	}
+	outOfDate := len(plan.Changes) > 0
+	if !reflect.DeepEqual(s.Objects.summary(), s.Before.summary()) {
+		s.Printf("out of date: .stencil/objects.json\n")
+		outOfDate = true
+	}
+
+	switch {
+	case len(unanswered) > 0:
+		return s.Errorf("check %v\n", ErrUnanswered)
+	case drift:
+		return s.Errorf("check %v\n", ErrDrift)
+	case outOfDate:
+		return s.Errorf("check %v\n", ErrOutOfDate)
+	}
+	return nil
+}
+
+// unanswered returns the names of all variables used by the last run
+// which were neither provided (see Vars.provided) nor saved
+// previously.
+func (s *Stencil) unanswered() []string {
+	result := append([]string{}, s.Vars.unanswered...)
+	sort.Strings(result)
+	return result
+}
+
+// errUnanswered wraps ErrUnanswered with the names and prompts of
+// the unanswered variables.
+func errUnanswered(questions []*Question) error {
+	lines := []string{}
+	for _, q := range questions {
+		lines = append(lines, "\n  "+q.Name+": "+q.Prompt)
+	}
+	return fmt.Errorf("%w:%s", ErrUnanswered, strings.Join(lines, ""))
+}
+
+// summary returns the parts of the objects that are determined by
+// the recipes, ignoring bookkeeping like digests.
+func (o *Objects) summary() interface{} {
+	type file struct {
+		Many                     bool
+		Loc, URL, File, Strategy string
+	}
+
+	files := map[string]file{}
+	for key, f := range o.Files {
+		files[key] = file{false, f.Loc, f.URL, "", f.Strategy}
+	}
+	archives := map[string]file{}
+	for key, f := range o.FileArchives {
+		archives[key] = file{f.Many, f.Loc, f.URL, f.File, ""}
+	}
+
+	return []interface{}{
+		nonNil(o.Pulls), nonNil(o.Deps), nonNil(o.Instances), files, archives,
+		nonNil(o.Bools), nonNil(o.Strings), nonNil(o.Ints), nonNil(o.Lists), nonNil(o.Maps),
+		nonNil(o.Definitions),
+	}
+}
+
+func nonNil(m interface{}) interface{} {
+	if v := reflect.ValueOf(m); v.Len() == 0 {
+		return nil
+	}
+	return m
+}
+
+// noPrompt is a Prompter which never prompts.  Variables which would
+// be prompted for are recorded as unanswered, except that variables
+// with a default take the default if defaults is set.
+type noPrompt struct {
+	defaults bool
+}
+
+func (noPrompt) PromptBool(prompt string) (bool, error) {
+	return false, ErrUnanswered
+}
+
+func (noPrompt) PromptString(prompt string) (string, error) {
+	return "", ErrUnanswered
+}
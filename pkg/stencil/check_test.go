@@ -0,0 +1,82 @@
+package stencil_test
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestCheck(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.DefineString "name" "Name" }}
+{{ stencil.CopyFile "a" "a.txt" "source" }}`,
+		"source": `{{ stencil.VarString "name" }}`,
+	}
+	discard := discardLogger{}
+	main := func(args ...string) error {
+		s := stencil.New(discard, discard, &fakePrompter{"boo"}, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+	check := func(expected int) {
+		t.Helper()
+		if code := stencil.ExitCode(main("check")); code != expected {
+			t.Error("Unexpected check exit code", code, expected)
+		}
+	}
+
+	fs[".stencil/objects.json"] = `{"Pulls": {"recipe": true}}`
+	check(stencil.ExitUnanswered)
+
+	if err := main("sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	check(0)
+
+	fs["a.txt"] = "edited"
+	check(stencil.ExitDrift)
+
+	fs["a.txt"] = "boo"
+	fs["source"] = "new"
+	check(stencil.ExitOutOfDate)
+	if fs["a.txt"] != "boo" {
+		t.Error("check modified the workspace", fs["a.txt"])
+	}
+
+	// unresolved conflicts fail even if the markers were removed.
+	fs["a.txt"] = "edited"
+	main("sync") //nolint: errcheck
+	if !strings.Contains(fs["a.txt"], "<<<<<<<") {
+		t.Fatal("Expected a conflict", fs["a.txt"])
+	}
+	fs["a.txt"] = "new"
+	check(stencil.ExitDrift)
+}
+
+type fakePrompter struct {
+	str string
+}
+
+func (f *fakePrompter) PromptBool(prompt string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakePrompter) PromptString(prompt string) (string, error) {
+	return f.str, nil
+}
+
+func TestCheckArchives(t *testing.T) {
+	fs := memFS{
+		"recipe":                `{{ stencil.CopyManyFromArchive "c" "bin" "https://example.com/c.zip" "*" }}`,
+		".stencil/objects.json": `{"Pulls": {"recipe": true}, "FileArchives": {"c": {"Many": true, "Loc": "bin", "URL": "https://example.com/c.zip", "File": "*", "Digests": {"bin/c": "` + stencil.Digest([]byte("c")) + `"}}}}`,
+		"bin/c":                 "c",
+	}
+	discard := discardLogger{}
+	s := stencil.New(discard, discard, nil, fs)
+	err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "check"})
+	if code := stencil.ExitCode(err); code != 0 {
+		t.Error("Unexpected check exit code", code, err)
+	}
+}
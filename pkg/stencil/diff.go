@@ -0,0 +1,181 @@
+package stencil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// ErrDiff is returned by Diff when sync would change the workspace.
+var ErrDiff = errors.New("workspace differs from recipes")
+
+// UnifiedDiff returns the unified diff between two texts or an empty
+// string if they are the same.
+func UnifiedDiff(a, b, aName, bName string) string {
+	al, bl := splitLines(a), splitLines(b)
+	ops := diffOps(al, bl)
+
+	var result strings.Builder
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*diffContext {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		if end -= unchanged; end+diffContext < len(ops) {
+			end += diffContext
+		} else {
+			end = len(ops)
+		}
+
+		if result.Len() == 0 {
+			fmt.Fprintf(&result, "--- %s\n+++ %s\n", aName, bName)
+		}
+		writeHunk(&result, ops[first:end])
+		start = end
+	}
+	return result.String()
+}
+
+type diffOp struct {
+	kind       byte
+	line       string
+	aIdx, bIdx int
+}
+
+func diffOps(a, b []string) []diffOp {
+	match := matchLines(a, b)
+	ops := []diffOp{}
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && match[i] == j:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && match[i] < 0:
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+func writeHunk(w *strings.Builder, ops []diffOp) {
+	acount, bcount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			acount++
+		}
+		if op.kind != '-' {
+			bcount++
+		}
+	}
+
+	astart, bstart := ops[0].aIdx, ops[0].bIdx
+	if acount > 0 {
+		astart++
+	}
+	if bcount > 0 {
+		bstart++
+	}
+	fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", astart, acount, bstart, bcount)
+
+	for _, op := range ops {
+		w.WriteByte(op.kind)
+		w.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			w.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Diff renders all the pulls in memory and prints the differences
+// with the workspace.  Files extracted from archives are summarized
+// by their size and digest.  It returns ErrDiff if there are any
+// differences.
+func (s *Stencil) Diff() error {
+	plan := NewPlan(s.FileSystem)
+	plan.Fetch = true
+	s.FileSystem = plan
+	defer func() { s.FileSystem = plan.FileSystem }()
+
+	if err := s.apply("", ""); err != nil {
+		return err
+	}
+
+	archived := map[string]bool{}
+	for _, f := range s.FileArchives {
+		for path := range f.Digests {
+			archived[path] = true
+		}
+	}
+
+	for _, c := range plan.Changes {
+		if err := s.printChange(plan, c, archived[c.Path]); err != nil {
+			return s.Errorf("diff %v\n", err)
+		}
+	}
+
+	if len(plan.Changes) > 0 {
+		return s.Errorf("diff %v\n", ErrDiff)
+	}
+	return nil
+}
+
+func (s *Stencil) printChange(plan *Plan, c Change, binary bool) error {
+	switch c.Op {
+	case OpDelete:
+		fmt.Fprintf(s.Stdout, "deleted %s\n", c.Path)
+		return nil
+	case OpDownload:
+		fmt.Fprintf(s.Stdout, "download %s into %s\n", c.URL, c.Path)
+		return nil
+	}
+
+	before, err := plan.FileSystem.Read(c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	after := plan.files[c.Path]
+
+	aName := "a/" + c.Path
+	if c.Op == OpCreate {
+		aName = "/dev/null"
+	}
+
+	if binary {
+		fmt.Fprintf(s.Stdout, "binary %s: %s => %s\n", c.Path, summary(before, c.Op == OpCreate), summary(after, false))
+		return nil
+	}
+	fmt.Fprint(s.Stdout, UnifiedDiff(string(before), string(after), aName, "b/"+c.Path))
+	return nil
+}
+
+func summary(data []byte, missing bool) string {
+	if missing {
+		return "none"
+	}
+	return fmt.Sprintf("%d bytes %s", len(data), Digest(data))
+}
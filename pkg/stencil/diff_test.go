@@ -0,0 +1,93 @@
+package stencil_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13"
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+\ No newline at end of file
+`
+	if got := stencil.UnifiedDiff(a, b, "a", "b"); got != expected {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+	if got := stencil.UnifiedDiff(a, a, "a", "b"); got != "" {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+	if got := stencil.UnifiedDiff("", "x\n", "a", "b"); got != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("Unexpected diff:\n%s", got)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.CopyFile "a" "a.txt" "source" }}`,
+		"source": "hello\n",
+	}
+	discard := discardLogger{}
+	main := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		s := stencil.New(discard, discard, nil, fs)
+		s.Stdout = &buf
+		args = append([]string{"stencil"}, args...)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+		return buf.String(), err
+	}
+
+	if _, err := main("pull", "recipe"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if out, err := main("diff"); err != nil || out != "" {
+		t.Fatal("Unexpected diff", out, err)
+	}
+
+	fs["source"] = "hello\nworld\n"
+	out, err := main("diff")
+	if !errors.Is(err, stencil.ErrDiff) {
+		t.Fatal("Unexpected diff result", err)
+	}
+	if !strings.Contains(out, "+world\n") {
+		t.Error("Unexpected diff", out)
+	}
+	if fs["a.txt"] != "hello\n" {
+		t.Error("diff modified the workspace", fs["a.txt"])
+	}
+}
+
+func TestDiffArchives(t *testing.T) {
+	fs := memFS{
+		"recipe":                `{{ stencil.CopyManyFromArchive "c" "bin" "https://example.com/c.zip" "*" }}`,
+		".stencil/objects.json": `{"Pulls": {"recipe": true}, "FileArchives": {"c": {"Many": true, "Loc": "bin", "URL": "https://example.com/c.zip", "File": "*", "Digests": {"bin/c": "` + stencil.Digest([]byte("c")) + `"}}}}`,
+		"bin/c":                 "c",
+	}
+
+	var out bytes.Buffer
+	discard := discardLogger{}
+	s := stencil.New(discard, discard, nil, fs)
+	s.Stdout = &out
+	if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "diff"}); err != nil || out.Len() > 0 {
+		t.Error("Unexpected diff", err, out.String())
+	}
+}
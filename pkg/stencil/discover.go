@@ -0,0 +1,109 @@
+package stencil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// discover runs all the pulls without making any changes (and
+// without downloading archives) to find the variables which have no
+// value, so that they are all asked for before anything is written.
+// The pulls are run again after every round of questions as the
+// answers may lead to more questions, such as those within an if.
+//
+// With --no-input, variables with a default take the default and
+// discover fails with ErrUnanswered listing all the other variables
+// without a value instead of asking.  The prompter is left
+// disabled for the real run in that case.
+func (s *Stencil) discover(add, rm string) error {
+	prompter := s.Prompter
+	if s.noInput {
+		prompter = noPrompt{defaults: true}
+	}
+	defer func() { s.Prompter = prompter }()
+
+	for {
+		questions, err := s.discoverPass(add, rm)
+		if len(questions) == 0 && err != nil {
+			return s.Errorf("%v\n", err)
+		}
+		if len(questions) == 0 {
+			return nil
+		}
+		for _, q := range questions {
+			// repeat the warnings about invalid global values
+			// which discoverPass did not log
+			s.Vars.globalValue(q.Name, q.VarDef) //nolint: errcheck
+		}
+		if s.noInput {
+			return s.Errorf("%v\n", errUnanswered(questions))
+		}
+
+		s.Prompter = prompter
+		if err := s.ask(questions); err != nil {
+			return s.Errorf("prompt %v\n", err)
+		}
+	}
+}
+
+// discoverPass runs all the pulls on top of a Plan, returning the
+// questions for the variables which would have been prompted for.
+// Nothing is logged and errors are returned along with the questions
+// as they may be caused by the missing values.
+func (s *Stencil) discoverPass(add, rm string) ([]*Question, error) {
+	instances := map[string]string{}
+	for name, url := range s.Instances {
+		instances[name] = url
+	}
+	plan := NewPlan(s.FileSystem)
+	printf, errorf := s.Printf, s.Errorf
+	s.FileSystem, s.Prompter = plan, noPrompt{defaults: s.noInput}
+	s.Printf = func(string, ...interface{}) {}
+	s.Errorf = func(format string, v ...interface{}) error {
+		return fmt.Errorf(strings.TrimSuffix(format, "\n"), v...)
+	}
+	defer func() {
+		s.FileSystem, s.Printf, s.Errorf = plan.FileSystem, printf, errorf
+		s.reset()
+		s.Instances = instances
+	}()
+
+	err := s.apply(add, rm)
+	questions := []*Question{}
+	for _, name := range s.Vars.unanswered {
+		questions = append(questions, s.Vars.question(name, s.Definitions[name]))
+	}
+	return questions, err
+}
+
+// ask asks all the questions, as a single form if the prompter is a
+// FormPrompter, and records the answers for the following runs.
+func (s *Stencil) ask(questions []*Question) error {
+	fp, ok := s.Prompter.(FormPrompter)
+	if !ok {
+		for _, q := range questions {
+			val, err := s.Vars.askQuestion(q)
+			if err != nil {
+				return err
+			}
+			s.Vars.answered[q.Name] = formatVar(val)
+		}
+		return nil
+	}
+
+	answers, err := fp.AskAll(questions)
+	if err == nil && len(answers) != len(questions) {
+		err = errors.New("missing answers")
+	}
+	if err != nil {
+		return err
+	}
+	for kk, q := range questions {
+		if err := q.Check(answers[kk]); err != nil {
+			return errors.New(q.Name + ": " + err.Error())
+		}
+		s.Vars.answered[q.Name] = answers[kk]
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package stencil_test
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestDiscover(t *testing.T) {
+	recipe := `{{ stencil.CopyFile "a" "a.txt" "a.tpl" }}
+{{ stencil.DefineBool "ci" "Enable CI" }}
+{{ if stencil.VarBool "ci" }}
+{{ stencil.DefineChoice "ci.provider" "CI provider" "github" "gitlab" }}
+{{ stencil.CopyFile "b" "b.txt" "b.tpl" }}
+{{ end }}`
+
+	t.Run("prompter", func(t *testing.T) {
+		fs := memFS{"recipe.md": recipe, "a.tpl": "a", "b.tpl": `{{ stencil.VarChoice "ci.provider" }}`}
+		p := &orderPrompter{fs: fs, answers: []string{"gitlab"}}
+		s := stencil.New(discardLogger{}, discardLogger{}, p, fs)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipe.md"})
+		if err != nil {
+			t.Fatal("pull", err)
+		}
+		if !reflect.DeepEqual(p.asked, []string{"Enable CI", "CI provider (github/gitlab)"}) || p.late {
+			t.Error("Unexpected prompts", p.asked, p.late)
+		}
+		if fs["b.txt"] != "gitlab" {
+			t.Error("Unexpected", fs["b.txt"])
+		}
+	})
+
+	t.Run("form", func(t *testing.T) {
+		fs := memFS{"recipe.md": recipe, "a.tpl": "a", "b.tpl": `{{ stencil.VarChoice "ci.provider" }}`}
+		p := &orderPrompter{fs: fs, answers: []string{"yes", "github"}}
+		s := stencil.New(discardLogger{}, discardLogger{}, p.form(), fs)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipe.md"})
+		if err != nil {
+			t.Fatal("pull", err)
+		}
+		if !reflect.DeepEqual(p.asked, []string{"ci", "|", "ci.provider", "|"}) || p.late {
+			t.Error("Unexpected forms", p.asked, p.late)
+		}
+		if fs["b.txt"] != "github" {
+			t.Error("Unexpected", fs["b.txt"])
+		}
+	})
+	t.Run("secrets", func(t *testing.T) {
+		fs := memFS{"recipe.md": `{{ stencil.DefineSecret "token" "Token" }}{{ stencil.VarSecret "token" }}` + recipe, "a.tpl": "a", "b.tpl": `{{ stencil.VarChoice "ci.provider" }}`}
+		p := &orderPrompter{fs: fs, answers: []string{"s3cret", "yes"}}
+		secrets := mapSecrets{}
+		s := stencil.New(discardLogger{}, discardLogger{}, p.form(), fs)
+		s.Secrets = secrets
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipe.md"})
+		if err == nil || len(secrets) != 0 {
+			t.Error("Secret saved before the real run", secrets, err)
+		}
+
+		p = &orderPrompter{fs: fs, answers: []string{"s3cret", "yes", "github"}}
+		s = stencil.New(discardLogger{}, discardLogger{}, p.form(), fs)
+		s.Secrets = secrets
+		err = s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipe.md"})
+		if err != nil || secrets["token"] != "s3cret" {
+			t.Error("Secret not saved", secrets, err)
+		}
+	})
+}
+
+// orderPrompter records the prompts and whether any of them came
+// after a file was written.
+type orderPrompter struct {
+	fs      memFS
+	answers []string
+	asked   []string
+	late    bool
+}
+
+func (o *orderPrompter) PromptBool(prompt string) (bool, error) {
+	o.record(prompt)
+	return true, nil
+}
+
+func (o *orderPrompter) PromptString(prompt string) (string, error) {
+	o.record(prompt)
+	answer := o.answers[0]
+	o.answers = o.answers[1:]
+	return answer, nil
+}
+
+func (o *orderPrompter) record(prompt string) {
+	if _, ok := o.fs["a.txt"]; ok {
+		o.late = true
+	}
+	o.asked = append(o.asked, prompt)
+}
+
+func (o *orderPrompter) form() stencil.Prompter {
+	return formPrompter{o}
+}
+
+type formPrompter struct {
+	*orderPrompter
+}
+
+func (f formPrompter) AskAll(questions []*stencil.Question) ([]string, error) {
+	answers := []string{}
+	for _, q := range questions {
+		if len(f.answers) == 0 {
+			return nil, errors.New("no more answers")
+		}
+		f.record(q.Name)
+		answers = append(answers, f.answers[0])
+		f.answers = f.answers[1:]
+	}
+	f.asked = append(f.asked, "|")
+	return answers, nil
+}
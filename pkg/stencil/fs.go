@@ -1,6 +1,8 @@
 package stencil
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"net/url"
@@ -10,33 +12,41 @@ import (
 
 	"golang.org/x/mod/semver"
 
-	"github.com/go-git/go-billy/v5"
-	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/cache"
-	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-// MaxFileSize specifies the max file size in the cache.
-const MaxFileSize = 1000000
-
 // FS implements a FileSystem interface.
+//
+// Git repositories are mirrored under CacheDir/git and http sources
+// are cached under CacheDir/http.  CacheDir defaults to stencil under
+// os.UserCacheDir.  Every branch, tag or http url is fetched at most
+// once per FS.  Credentials are tried in order when fetching
+// and default to DefaultCredentials().
 type FS struct {
 	BaseDir         string
+	CacheDir        string
+	Credentials     []GitCredentials
 	Verbose, Errorl Logger
+
+	fetched   map[string]plumbing.Hash
+	responses map[string][]byte
 }
 
-// Remove removes a file.
+// Remove removes a file within the local directory.
 func (fs *FS) Remove(path string) error {
 	fs.Verbose.Printf("Deleting file %s\n", path)
-	return os.Remove(path)
+	return os.Remove(filepath.Join(fs.BaseDir, filepath.Clean(path)))
 }
 
-// RemoveAll removes a directory and all its contents.
+// RemoveAll removes a directory within the local directory and all
+// its contents.
 func (fs *FS) RemoveAll(path string) error {
 	fs.Verbose.Printf("Deleting dir %s\n", path)
-	return os.RemoveAll(path)
+	return os.RemoveAll(filepath.Join(fs.BaseDir, filepath.Clean(path)))
 }
 
 // Write saves a file within the local directory.
@@ -53,41 +63,53 @@ func (fs *FS) Write(path string, data []byte, mode os.FileMode) error {
 func (fs *FS) Read(path string) ([]byte, error) {
 	if _, _, gitPath, ok := fs.parseGitURL(path); ok {
 		var result []byte
-		err := fs.withGit(path, func(r *git.Repository, bfs billy.Filesystem) error {
-			f, err := bfs.Open(gitPath)
+		err := fs.withGit(path, func(c *object.Commit) error {
+			f, err := c.File(strings.TrimPrefix(gitPath, "/"))
 			if err != nil {
 				return err
 			}
-			defer f.Close()
 
-			result, err = ioutil.ReadAll(f)
+			contents, err := f.Contents()
+			result = []byte(contents)
 			return err
 		})
 		return result, err
 	}
+	if isHTTP(path) {
+		return fs.readHTTP(path)
+	}
 	return ioutil.ReadFile(filepath.Join(fs.BaseDir, filepath.Clean(path)))
 }
 
-// Resolve pins a git path to a specific hash/commit.
+// Pinnable returns true if the path is a git path which can be pinned
+// to a commit.
+func (fs *FS) Pinnable(path string) bool {
+	_, _, _, ok := fs.parseGitURL(path)
+	return ok
+}
+
+// Resolve returns the hash of the commit a git path refers to.
 func (fs *FS) Resolve(path string) (string, error) {
-	branch, cloneURL, path, ok := fs.parseGitURL(path)
-	if !ok {
+	if _, _, _, ok := fs.parseGitURL(path); !ok {
 		return "", errors.New("not a git url: " + path)
 	}
 
-	err := fs.withGit(path, func(r *git.Repository, _ billy.Filesystem) error {
-		head, err := r.Head()
-		if err != nil {
-			return err
-		}
-
-		branch = head.Name().Short()
+	var hash string
+	err := fs.withGit(path, func(c *object.Commit) error {
+		hash = c.Hash.String()
 		return nil
 	})
-	if err != nil {
-		return "", err
+	return hash, err
+}
+
+// Pin returns the git path pinned to the provided commit hash.  It
+// returns false if the path is not a git path.
+func (fs *FS) Pin(path, hash string) (string, bool) {
+	_, cloneURL, gitPath, ok := fs.parseGitURL(path)
+	if !ok {
+		return "", false
 	}
-	return "git:" + cloneURL + "#" + branch + path, nil
+	return "git:" + cloneURL + "#" + hash + gitPath, true
 }
 
 func (fs *FS) parseGitURL(gitURL string) (branch, cloneURL, path string, ok bool) {
@@ -114,40 +136,188 @@ func (fs *FS) parseGitURL(gitURL string) (branch, cloneURL, path string, ok bool
 		branch = u.Fragment
 	}
 	cloneURL = u.Host + path
-	path = cloneURL[strings.Index(cloneURL, ".git/")+4:]
-	cloneURL = cloneURL[:strings.Index(cloneURL, ".git/")+4]
+	idx := strings.Index(cloneURL, ".git/")
+	if idx < 0 {
+		return "", "", "", false
+	}
+	path = cloneURL[idx+4:]
+	cloneURL = cloneURL[:idx+4]
 	return branch, cloneURL, path, true
 }
 
-// withGit calls te provided function on the git directory.
-func (fs *FS) withGit(url string, fn func(r *git.Repository, fs billy.Filesystem) error) error {
+// isRemote returns true for git and http urls.
+func isRemote(path string) bool {
+	_, _, _, ok := (&FS{}).parseGitURL(path)
+	return ok || isHTTP(path)
+}
+
+// remoteURL returns the url to fetch a repository from.  Local paths
+// which are not absolute are relative to BaseDir.
+func (fs *FS) remoteURL(cloneURL string) (string, error) {
+	if strings.Contains(cloneURL, "://") || filepath.IsAbs(cloneURL) {
+		return cloneURL, nil
+	}
+
+	// scp-like syntax: user@host:path
+	if idx := strings.Index(cloneURL, ":"); idx >= 0 && !strings.Contains(cloneURL[:idx], "/") {
+		return cloneURL, nil
+	}
+	return filepath.Abs(filepath.Join(fs.BaseDir, cloneURL))
+}
+
+// withGit calls the provided function with the commit the git url
+// refers to.
+func (fs *FS) withGit(url string, fn func(c *object.Commit) error) error {
 	branch, cloneURL, _, _ := fs.parseGitURL(url)
 
-	objectsDir, err := ioutil.TempDir("", "stencil-git-objects")
+	cloneURL, err := fs.remoteURL(cloneURL)
+	if err != nil {
+		return err
+	}
+	r, err := fs.mirror(cloneURL)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(objectsDir)
-	workDir, err := ioutil.TempDir("", "stencil-git-work")
+
+	hash, err := fs.fetch(r, cloneURL, branch)
 	if err != nil {
+		fs.Errorl.Printf("git fetch %s %v\n", cloneURL, err)
 		return err
 	}
-	defer os.RemoveAll(workDir)
 
-	objs := filesystem.NewStorage(osfs.New(objectsDir), cache.NewObjectLRU(MaxFileSize))
-	work := osfs.New(workDir)
-	r, err := git.Clone(objs, work, &git.CloneOptions{
-		URL:           cloneURL,
-		ReferenceName: fs.refName(branch),
-		SingleBranch:  true,
-		Progress:      progress{fs},
-		Tags:          git.AllTags,
+	c, err := fs.commit(r, hash)
+	if err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+// mirror opens the bare mirror of the repository in the cache,
+// creating it if needed.
+func (fs *FS) mirror(cloneURL string) (*git.Repository, error) {
+	dir, err := fs.cachePath("git", cloneURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := git.PlainOpen(dir)
+	if err != git.ErrRepositoryNotExists {
+		return r, err
+	}
+
+	if r, err = git.PlainInit(dir, true); err != nil {
+		return nil, err
+	}
+	_, err = r.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{cloneURL},
 	})
+	return r, err
+}
+
+// cachePath returns the path within the cache for the key.
+func (fs *FS) cachePath(kind, key string) (string, error) {
+	cacheDir := fs.CacheDir
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(dir, "stencil")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(cacheDir, kind, hex.EncodeToString(sum[:])), nil
+}
+
+// fetch updates the ref in the mirror if it has not already been
+// fetched by this FS and returns the hash it points to.
+//
+// The ref can be a branch, a tag, a full or abbreviated commit hash
+// or a semver constraint (such as ^1.2, ~1.4.0 or ">=2.0.0 <3") which
+// is resolved to the highest matching tag of the remote.  Commit
+// hashes are only fetched if they are not already in the mirror and
+// abbreviated hashes only if no branch or tag has the same name.
+func (fs *FS) fetch(r *git.Repository, cloneURL, branch string) (plumbing.Hash, error) {
+	key := cloneURL + "#" + branch
+	if hash, ok := fs.fetched[key]; ok {
+		return hash, nil
+	}
+
+	var hash plumbing.Hash
+	var err error
+	switch {
+	case isCommitHash(branch):
+		hash, err = fs.fetchCommit(r, plumbing.NewHash(branch))
+	case isAbbrevHash(branch):
+		hash, err = fs.fetchHexRef(r, branch)
+	case isConstraint(branch):
+		hash, err = fs.fetchConstraint(r, branch)
+	default:
+		hash, err = fs.fetchRef(r, fs.refName(branch))
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if fs.fetched == nil {
+		fs.fetched = map[string]plumbing.Hash{}
+	}
+	fs.fetched[key] = hash
+	return hash, nil
+}
+
+func (fs *FS) fetchRef(r *git.Repository, ref plumbing.ReferenceName) (plumbing.Hash, error) {
+	if err := fs.fetchSpecs(r, config.RefSpec("+"+ref+":"+ref)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	resolved, err := r.Reference(ref, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return resolved.Hash(), nil
+}
+
+func (fs *FS) fetchCommit(r *git.Repository, hash plumbing.Hash) (plumbing.Hash, error) {
+	if _, err := r.Object(plumbing.AnyObject, hash); err == nil {
+		return hash, nil
+	}
+
+	err := fs.fetchSpecs(r, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	_, err = r.Object(plumbing.AnyObject, hash)
+	return hash, err
+}
+
+func (fs *FS) fetchSpecs(r *git.Repository, specs ...config.RefSpec) error {
+	remote, err := r.Remote(git.DefaultRemoteName)
 	if err != nil {
-		fs.Errorl.Printf("git clone %s %v\n", cloneURL, err)
 		return err
 	}
-	return fn(r, work)
+
+	return fs.withAuth(remote.Config().URLs[0], func(auth transport.AuthMethod) error {
+		err := remote.Fetch(&git.FetchOptions{
+			RefSpecs: specs,
+			Auth:     auth,
+			Progress: progress{fs},
+			Tags:     git.NoTags,
+		})
+		if err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		return err
+	})
+}
+
+// commit returns the commit for a hash, peeling annotated tags.
+func (fs *FS) commit(r *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if tag, err := r.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+	return r.CommitObject(hash)
 }
 
 func (fs *FS) refName(branch string) plumbing.ReferenceName {
@@ -157,6 +327,14 @@ func (fs *FS) refName(branch string) plumbing.ReferenceName {
 	return plumbing.NewBranchReferenceName(branch)
 }
 
+func isCommitHash(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
 type progress struct {
 	*FS
 }
@@ -0,0 +1,190 @@
+package stencil_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestFSGitCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := newGitRepo(t, filepath.Join(dir, "repo.git"))
+	repo.commit("recipe.md", "v1")
+
+	discard := discardLogger{}
+	cache := filepath.Join(dir, "cache")
+	fs := &stencil.FS{CacheDir: cache, Verbose: discard, Errorl: discard}
+	url := "git://" + repo.dir + "/recipe.md"
+
+	read := func(fs *stencil.FS, expected string) {
+		t.Helper()
+		data, err := fs.Read(url)
+		if err != nil || string(data) != expected {
+			t.Fatalf("Read: %q %v", data, err)
+		}
+	}
+
+	read(fs, "v1")
+	repo.commit("recipe.md", "v2")
+	read(fs, "v1")
+
+	if entries, err := ioutil.ReadDir(cache); err != nil || len(entries) != 1 {
+		t.Fatal("Unexpected cache", entries, err)
+	}
+
+	read(&stencil.FS{CacheDir: cache, Verbose: discard, Errorl: discard}, "v2")
+}
+
+func TestFSLocalRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := newGitRepo(t, filepath.Join(dir, "repo.git"))
+	repo.commit("recipes/go.md", "hello")
+
+	discard := discardLogger{}
+	fs := &stencil.FS{
+		BaseDir:  filepath.Join(dir, "work"),
+		CacheDir: filepath.Join(dir, "cache"),
+		Verbose:  discard,
+		Errorl:   discard,
+	}
+	urls := []string{
+		"git:file://" + repo.dir + "/recipes/go.md",
+		"git:file://" + repo.dir + "#master/recipes/go.md",
+		"git:../repo.git/recipes/go.md",
+		"git:" + repo.dir + "/recipes/go.md",
+	}
+	for _, url := range urls {
+		if data, err := fs.Read(url); err != nil || string(data) != "hello" {
+			t.Errorf("%s: got %q %v", url, data, err)
+		}
+	}
+}
+
+type gitRepo struct {
+	t        *testing.T
+	dir, src string
+}
+
+// newGitRepo creates a bare repo at dir.  Commits are made in a
+// separate work tree and pushed to the bare repo.
+func newGitRepo(t *testing.T, dir string) *gitRepo {
+	r := &gitRepo{t, dir, dir + ".src"}
+	r.git("", "init", "-q", "--bare", dir)
+	r.git("", "init", "-q", r.src)
+	return r
+}
+
+func (r *gitRepo) commit(path, contents string) {
+	r.t.Helper()
+	fname := filepath.Join(r.src, path)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		r.t.Fatal("MkdirAll", err)
+	}
+	if err := ioutil.WriteFile(fname, []byte(contents), 0644); err != nil {
+		r.t.Fatal("WriteFile", err)
+	}
+	r.git(r.src, "add", ".")
+	r.git(r.src, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", path)
+	r.git(r.src, "push", "-q", r.dir, "HEAD:refs/heads/master")
+}
+
+func (r *gitRepo) git(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatal("git", args, err, string(output))
+	}
+	return string(output)
+}
+
+func TestFSHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	requests, notModified := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "hello")
+	}))
+	defer srv.Close()
+
+	discard := discardLogger{}
+	for _, expected := range []int{1, 2} {
+		fs := &stencil.FS{CacheDir: dir, Verbose: discard, Errorl: discard}
+		for kk := 0; kk < 2; kk++ {
+			if data, err := fs.Read(srv.URL + "/recipe.md"); err != nil || string(data) != "hello" {
+				t.Fatalf("Read: %q %v", data, err)
+			}
+		}
+		if requests != expected || notModified != expected-1 {
+			t.Error("Unexpected requests", requests, notModified)
+		}
+	}
+}
+
+func TestFSPinnable(t *testing.T) {
+	fs := &stencil.FS{}
+	urls := map[string]bool{
+		"git://github.com/a/b.git/recipe.md":       true,
+		"git:github.com/a/b.git#v1/recipe.md":      true,
+		"git://github.com/a/b/recipe.md":           false,
+		"https://github.com/a/b.git/raw/recipe.md": false,
+		"recipes/go.md":                            false,
+	}
+	for url, expected := range urls {
+		if fs.Pinnable(url) != expected {
+			t.Error("Unexpected Pinnable", url, !expected)
+		}
+	}
+}
+
+func TestFSRemoveBaseDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	discard := discardLogger{}
+	fs := &stencil.FS{BaseDir: dir, Verbose: discard, Errorl: discard}
+	if err := fs.Write("a/b.txt", []byte("b"), 0666); err != nil {
+		t.Fatal("Write", err)
+	}
+	if err := fs.Remove("a/b.txt"); err != nil {
+		t.Error("Remove", err)
+	}
+	if err := fs.RemoveAll("a"); err != nil {
+		t.Error("RemoveAll", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Error("Unexpected", err)
+	}
+}
@@ -0,0 +1,116 @@
+package stencil
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The sources of variables recorded in Objects.Sources other than
+// --var, the names of environment variables and answers files.
+const (
+	SourcePrompt  = "prompt"
+	SourceGlobal  = "global"
+	SourceSet     = "vars set"
+	SourceDefault = "default"
+)
+
+// GlobalVars holds the values of variables shared by all workspaces,
+// such as the name of the author or the preferred license.  They are
+// used for variables which have no value in the workspace instead of
+// prompting.
+//
+// The values are saved in Path as a JSON object.  Like with
+// --answers, the values are either in the text form used with --var
+// or native JSON values.
+type GlobalVars struct {
+	Path string
+
+	values map[string]string
+	err    error
+}
+
+// DefaultGlobalVars returns the global values saved in the user
+// config directory, typically ~/.config/stencil/vars.json.  Without a
+// config directory there are no global values and listing or changing
+// them fails.
+func DefaultGlobalVars() *GlobalVars {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return &GlobalVars{values: map[string]string{}, err: err}
+	}
+	return &GlobalVars{Path: filepath.Join(dir, "stencil", "vars.json")}
+}
+
+// Get returns the global value of a variable.
+func (g *GlobalVars) Get(name string) (string, bool, error) {
+	if err := g.load(); err != nil {
+		return "", false, err
+	}
+	value, ok := g.values[name]
+	return value, ok, nil
+}
+
+// All returns all the global values.
+func (g *GlobalVars) All() (map[string]string, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+	return g.values, nil
+}
+
+// Set changes the global value of a variable.
+func (g *GlobalVars) Set(name, value string) error {
+	if err := g.load(); err != nil {
+		return err
+	}
+	g.values[name] = value
+	return g.save()
+}
+
+// Delete removes the global value of a variable.
+func (g *GlobalVars) Delete(name string) error {
+	if err := g.load(); err != nil {
+		return err
+	}
+	delete(g.values, name)
+	return g.save()
+}
+
+func (g *GlobalVars) load() error {
+	if g.values != nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(g.Path)
+	if os.IsNotExist(err) {
+		g.values = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if g.values, err = decodeAnswers(data, true); err != nil {
+		return errors.New(g.Path + ": " + err.Error())
+	}
+	return nil
+}
+
+func (g *GlobalVars) save() error {
+	if g.err != nil {
+		return g.err
+	}
+	data, err := json.MarshalIndent(g.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.Path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(g.Path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,101 @@
+package stencil_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestGlobalVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stencil", "vars.json")
+
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "author" "Author" }}
+{{ stencil.DefineInt "replicas" "Replicas" 1 10 }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}`,
+		"tpl": `{{ stencil.VarString "author" }} {{ stencil.VarInt "replicas" }}`,
+	}
+
+	discard := discardLogger{}
+	errs := &logLines{}
+	main := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		s := stencil.New(discard, errs, &fakePrompter{"7"}, fs)
+		s.Stdout = &out
+		s.Globals = &stencil.GlobalVars{Path: path}
+		args = append([]string{"stencil"}, args...)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+		return out.String(), err
+	}
+
+	if _, err := main("vars", "set", "--global", "author=Ada"); err != nil {
+		t.Fatal("set", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"author": "Ada", "replicas": 20}`), 0644); err != nil {
+		t.Fatal("WriteFile", err)
+	}
+
+	if _, err := main("pull", "recipe.md", "--as", "api"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if fs["out.txt"] != "Ada 7" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+	if errs.count("globals "+path+": ignoring invalid value of replicas") == 0 {
+		t.Error("Missing warning", *errs)
+	}
+
+	out, err := main("vars", "list")
+	for _, s := range []string{"api:author    string  Ada    global", "api:replicas  int     7      prompt"} {
+		if err != nil || !strings.Contains(out, s) {
+			t.Error("Missing", s, "in", out, err)
+		}
+	}
+
+	if _, err := main("vars", "set", "--global", "api:replicas=20"); err == nil {
+		t.Error("Unexpected success setting an out of range global value")
+	}
+	if _, err := main("vars", "unset", "--global", "author"); err != nil {
+		t.Error("unset", err)
+	}
+	if out, err := main("vars", "list", "--global"); err != nil || strings.Contains(out, "author") || !strings.Contains(out, "replicas") {
+		t.Error("Unexpected", out, err)
+	}
+	if out, err := main("vars", "get", "api:author"); err != nil || out != "Ada\n" {
+		t.Error("Unexpected", out, err)
+	}
+	if out, err := main("vars", "get", "--global", "replicas"); err != nil || out != "20\n" {
+		t.Error("Unexpected", out, err)
+	}
+	if _, err := main("vars", "get", "--global", "author"); err == nil {
+		t.Error("Unexpected success getting a missing global value")
+	}
+}
+
+func TestGlobalVarsWithoutConfigDir(t *testing.T) {
+	for _, name := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	g := stencil.DefaultGlobalVars()
+	if _, ok, err := g.Get("author"); ok || err != nil {
+		t.Error("Unexpected global value", ok, err)
+	}
+	if _, err := g.All(); err == nil {
+		t.Error("Unexpected success listing global values")
+	}
+	if err := g.Set("author", "Ada"); err == nil {
+		t.Error("Unexpected success setting a global value")
+	}
+}
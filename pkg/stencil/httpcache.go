@@ -0,0 +1,98 @@
+package stencil
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// httpCacheEntry holds the validators of a cached http response.
+type httpCacheEntry struct {
+	ETag, LastModified string
+}
+
+// readHTTP fetches an http url.  Responses are cached and revalidated
+// using ETag and Last-Modified on later runs.
+func (fs *FS) readHTTP(url string) ([]byte, error) {
+	if data, ok := fs.responses[url]; ok {
+		return data, nil
+	}
+
+	path, err := fs.cachePath("http", url)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry httpCacheEntry
+	cached, err := ioutil.ReadFile(path)
+	if err == nil {
+		var meta []byte
+		if meta, err = ioutil.ReadFile(path + ".json"); err == nil {
+			err = json.Unmarshal(meta, &entry)
+		}
+	}
+	if err != nil {
+		cached, entry = nil, httpCacheEntry{}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if cached != nil && entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		fs.Verbose.Printf("Using cached %s\n", url)
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &os.PathError{Op: "get", Path: url, Err: os.ErrNotExist}
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New("http.Status " + resp.Status)
+	default:
+		if cached, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+		entry = httpCacheEntry{resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")}
+		if err = fs.saveHTTP(path, cached, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if fs.responses == nil {
+		fs.responses = map[string][]byte{}
+	}
+	fs.responses[url] = cached
+	return cached, nil
+}
+
+func (fs *FS) saveHTTP(path string, data []byte, entry httpCacheEntry) error {
+	if entry.ETag == "" && entry.LastModified == "" {
+		return nil
+	}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0766); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, data, 0666); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+".json", meta, 0666)
+}
@@ -0,0 +1,42 @@
+package stencil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestInclude(t *testing.T) {
+	fs := memFS{
+		"main.tpl":       `{{ stencil.Include "lib/common.tpl" }}{{ template "arch" "x86_64" }}`,
+		"lib/common.tpl": `{{ define "arch" }}{{ if eq . "x86_64" }}amd64{{ else }}{{ . }}{{ end }}{{ end }}common `,
+	}
+
+	discard := discardLogger{}
+	got, err := stencil.New(discard, discard, nil, fs).Execute("main.tpl")
+	if err != nil || got != "common amd64" {
+		t.Error("Unexpected", got, err)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	cases := map[string]string{
+		"lib/bad.tpl":   `{{ template "missing" }}`,
+		"lib/cycle.tpl": `{{ stencil.Include "../main.tpl" }}`,
+	}
+
+	for name, code := range cases {
+		t.Run(name, func(t *testing.T) {
+			fs := memFS{
+				"main.tpl": `{{ stencil.Include "` + name + `" }}`,
+				name:       code,
+			}
+			discard := discardLogger{}
+			_, err := stencil.New(discard, discard, nil, fs).Execute("main.tpl")
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Error("Unexpected", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package stencil_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestInstances(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "pkg.Name" "Package?" }}
+{{ $name := stencil.VarString "pkg.Name" }}
+{{ stencil.CopyFile "go" (printf "pkg/%s/%s.go" $name $name) "file.go.tpl" }}`,
+		"file.go.tpl": `package {{ stencil.VarString "pkg.Name" }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(args ...string) {
+		t.Helper()
+		s := stencil.New(discard, discard, nil, fs)
+		args = append([]string{"stencil"}, args...)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args); err != nil {
+			t.Fatal("Main", args, err)
+		}
+	}
+
+	main("pull", "recipe.md", "--as", "api", "--var", "pkg.Name=api")
+	main("pull", "recipe.md", "--as", "web", "--var", "pkg.Name=web")
+	main("sync")
+	if fs["pkg/api/api.go"] != "package api" || fs["pkg/web/web.go"] != "package web" {
+		t.Fatal("Unexpected", fs)
+	}
+
+	main("sync", "--var", "web:pkg.Name=www")
+	if _, ok := fs["pkg/web/web.go"]; ok || fs["pkg/www/www.go"] != "package www" {
+		t.Error("Unexpected", fs)
+	}
+
+	main("rm", "api")
+	if _, ok := fs["pkg/api/api.go"]; ok {
+		t.Error("Instance was not removed", fs)
+	}
+	if fs["pkg/www/www.go"] != "package www" {
+		t.Error("Other instance was removed", fs)
+	}
+}
@@ -0,0 +1,93 @@
+package stencil
+
+import (
+	"encoding/json"
+	"os"
+)
+
+const lockFile = ".stencil/lock.json"
+
+// pinner is implemented by file systems which can pin urls to
+// specific commits, such as FS.
+type pinner interface {
+	Pinnable(path string) bool
+	Resolve(path string) (string, error)
+	Pin(path, hash string) (string, bool)
+}
+
+// Locks pins every git url read by a pull to a specific commit.  The
+// pins are saved in .stencil/lock.json and are reused by later runs
+// until they are explicitly updated.
+type Locks struct {
+	*Stencil `json:"-"`
+	Pins     map[string]map[string]string
+
+	locked map[string]map[string]string
+	update map[string]bool
+}
+
+// LoadLocks loads the pins from .stencil/lock.json.  Pins of pulls
+// being updated are dropped.
+func (l *Locks) LoadLocks() error {
+	data, err := l.Read(lockFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved Locks
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for pull, pins := range saved.Pins {
+		if !l.update["*"] && !l.update[pull] {
+			l.locked[pull] = pins
+		}
+	}
+	return nil
+}
+
+// SaveLocks saves all the pins used by the current run.
+func (l *Locks) SaveLocks() error {
+	data, err := json.MarshalIndent(l, "", "  ") //nolint: staticcheck
+	if err != nil {
+		return err
+	}
+	return l.Write(lockFile, data, 0666)
+}
+
+// UpdateLocks marks the pins of the provided pull (or all pulls if
+// pull is empty) to be moved forward on the next run.
+func (l *Locks) UpdateLocks(pull string) {
+	if pull == "" {
+		pull = "*"
+	}
+	l.update[pull] = true
+}
+
+// pinned returns the url pinned to the commit recorded for the current
+// pull, resolving and recording the commit if it is not pinned yet.
+// Urls which cannot be pinned are returned as is.
+func (l *Locks) pinned(url string) (string, error) {
+	p, ok := l.FileSystem.(pinner)
+	if !ok || !p.Pinnable(url) {
+		return url, nil
+	}
+
+	hash, ok := l.locked[l.pull][url]
+	if !ok {
+		var err error
+		if hash, err = p.Resolve(url); err != nil {
+			return "", err
+		}
+	}
+
+	if l.Pins[l.pull] == nil {
+		l.Pins[l.pull] = map[string]string{}
+	}
+	l.Pins[l.pull][url] = hash
+	pinned, _ := p.Pin(url, hash)
+	return pinned, nil
+}
@@ -0,0 +1,59 @@
+package stencil_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := newGitRepo(t, filepath.Join(dir, "repo.git"))
+	recipe := "git://" + repo.dir + "/recipe.md"
+	repo.commit("recipe.md", `{{ stencil.CopyFile "t" "out.txt" "git://`+repo.dir+`/tpl.txt" }}`)
+	repo.commit("tpl.txt", "v1")
+
+	work := filepath.Join(dir, "work")
+	discard := discardLogger{}
+	main := func(args ...string) string {
+		t.Helper()
+		fs := &stencil.FS{BaseDir: work, CacheDir: filepath.Join(dir, "cache"), Verbose: discard, Errorl: discard}
+		s := stencil.New(discard, discard, nil, fs)
+		args = append([]string{"stencil"}, args...)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args); err != nil {
+			t.Fatal("Main", args, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(work, "out.txt"))
+		if err != nil {
+			t.Fatal("ReadFile", err)
+		}
+		return string(data)
+	}
+
+	if got := main("pull", recipe); got != "v1" {
+		t.Fatal("Unexpected pull", got)
+	}
+	lock, err := ioutil.ReadFile(filepath.Join(work, ".stencil/lock.json"))
+	head := strings.TrimSpace(repo.git(repo.dir, "rev-parse", "master"))
+	if err != nil || !strings.Contains(string(lock), head) {
+		t.Fatal("Unexpected lock", string(lock), err)
+	}
+
+	repo.commit("tpl.txt", "v2")
+	if got := main("sync"); got != "v1" {
+		t.Error("sync did not honor lock", got)
+	}
+	if got := main("update", recipe); got != "v2" {
+		t.Error("update did not move pins", got)
+	}
+}
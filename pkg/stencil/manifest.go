@@ -0,0 +1,95 @@
+package stencil
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+const manifestFile = ".stencil/manifest.json"
+
+// Manifest lists the pulls and the variable values of a workspace.
+// It is saved in .stencil/manifest.json and is meant to be edited by
+// hand and committed: sync derives everything else from it.
+//
+// Everything stencil records about what it did (the files copied,
+// their digests, dependencies and conflicts) is kept separately in
+// .stencil/objects.json.
+type Manifest struct {
+	Pulls   []ManifestPull
+	Bools   map[string]bool              `json:",omitempty"`
+	Strings map[string]string            `json:",omitempty"`
+	Ints    map[string]int               `json:",omitempty"`
+	Lists   map[string][]string          `json:",omitempty"`
+	Maps    map[string]map[string]string `json:",omitempty"`
+}
+
+// ManifestPull is a single pull of a recipe.  As is the name of the
+// instance for recipes pulled via --as.  Git urls can include a
+// branch, tag, commit or semver constraint after a "#".
+type ManifestPull struct {
+	URL string
+	As  string `json:",omitempty"`
+}
+
+// loadManifest replaces the pulls, instances and variables loaded
+// from objects.json with those in the manifest, if there is one.
+func (o *Objects) loadManifest() error {
+	data, err := o.Read(manifestFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	before := o.Before
+	for pull, explicit := range before.Pulls {
+		if explicit {
+			delete(before.Pulls, pull)
+		}
+	}
+	if before.Pulls == nil {
+		before.Pulls = map[string]bool{}
+	}
+	before.Instances = map[string]string{}
+	for _, p := range m.Pulls {
+		if p.As == "" {
+			before.Pulls[p.URL] = true
+			continue
+		}
+		before.Pulls[p.As] = true
+		before.Instances[p.As] = p.URL
+	}
+	before.Bools, before.Strings = m.Bools, m.Strings
+	before.Ints, before.Lists, before.Maps = m.Ints, m.Lists, m.Maps
+	return nil
+}
+
+// manifest returns the manifest for the current objects.
+func (o *Objects) manifest() *Manifest {
+	m := &Manifest{
+		Pulls: []ManifestPull{},
+		Bools: o.Bools, Strings: o.Strings,
+		Ints: o.Ints, Lists: o.Lists, Maps: o.Maps,
+	}
+	for pull, explicit := range o.Pulls {
+		if !explicit {
+			continue
+		}
+		if url, ok := o.Instances[pull]; ok {
+			m.Pulls = append(m.Pulls, ManifestPull{URL: url, As: pull})
+		} else {
+			m.Pulls = append(m.Pulls, ManifestPull{URL: pull})
+		}
+	}
+	sort.Slice(m.Pulls, func(i, j int) bool {
+		return m.Pulls[i].As+"\x00"+m.Pulls[i].URL < m.Pulls[j].As+"\x00"+m.Pulls[j].URL
+	})
+	return m
+}
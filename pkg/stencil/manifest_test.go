@@ -0,0 +1,60 @@
+package stencil_test
+
+import (
+	"encoding/json"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestManifest(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "name" "Name?" }}
+{{ stencil.CopyFile "f" (printf "%s.txt" (stencil.VarString "name")) "file.tpl" }}`,
+		"file.tpl": `{{ stencil.VarString "name" }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(args ...string) {
+		t.Helper()
+		s := stencil.New(discard, discard, &fakePrompter{"boo"}, fs)
+		args = append([]string{"stencil"}, args...)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args); err != nil {
+			t.Fatal("Main", args, err)
+		}
+	}
+
+	main("pull", "recipe.md")
+	var m stencil.Manifest
+	if err := json.Unmarshal([]byte(fs[".stencil/manifest.json"]), &m); err != nil {
+		t.Fatal("Unmarshal", err)
+	}
+	expected := stencil.Manifest{
+		Pulls:   []stencil.ManifestPull{{URL: "recipe.md"}},
+		Strings: map[string]string{"name": "boo"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Error("Unexpected manifest", fs[".stencil/manifest.json"])
+	}
+	if strings.Contains(fs[".stencil/objects.json"], `"Strings"`) || strings.Contains(fs[".stencil/objects.json"], `"recipe.md": true`) {
+		t.Error("Pulls or variables saved in objects.json", fs[".stencil/objects.json"])
+	}
+
+	fs[".stencil/manifest.json"] = `{
+  "Pulls": [{"URL": "recipe.md", "As": "x"}],
+  "Strings": {"x:name": "foo"}
+}`
+	main("sync")
+	if _, ok := fs["boo.txt"]; ok || fs["foo.txt"] != "foo" {
+		t.Error("Unexpected files", fs)
+	}
+
+	fs[".stencil/manifest.json"] = `{"Pulls": []}`
+	main("sync")
+	if _, ok := fs["foo.txt"]; ok {
+		t.Error("Unexpected files", fs)
+	}
+}
@@ -17,11 +17,20 @@ type Markdown struct {
 //
 // Note that standard go templates are still executed on top of this
 // so the embedded code can use any stencil function.
+//
+// Local changes are merged just like with CopyFile.
 func (m *Markdown) CopyMarkdownSnippets(key, localPath, url, regex string) error {
+	resolved, err := m.resolve(url)
+	if err != nil {
+		return m.Errorf("Error resolving %s %v\n", url, err)
+	}
+	url = resolved
+
 	m.Printf("copying %s (snippets %s) to %s, key (%s)\n", url, regex, localPath, key)
 
+	strategy := m.Objects.strategy(key)
 	key = key + "(regex: " + regex + ")"
-	m.Objects.addFile(key, localPath, url)
+	f := m.Objects.addFile(key, localPath, url, strategy)
 
 	data, err := m.executeFilter(url, func(md string) (string, error) {
 		return m.FilterMarkdown(md, regex)
@@ -30,7 +39,8 @@ func (m *Markdown) CopyMarkdownSnippets(key, localPath, url, regex string) error
 		return m.Errorf("Error reading %s %v\n", url, err)
 	}
 
-	return m.Write(localPath, []byte(data), 0666)
+	_, err = m.writeMerged(f, []byte(data))
+	return err
 }
 
 func (m *Markdown) FilterMarkdown(data, regex string) (string, error) {
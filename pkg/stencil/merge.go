@@ -0,0 +1,217 @@
+package stencil
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baseDir holds the last rendered output of every managed file.  It
+// is used as the merge base when the local file has been edited.
+const baseDir = ".stencil/base"
+
+const (
+	conflictLocal    = "<<<<<<< local\n"
+	conflictSep      = "=======\n"
+	conflictUpstream = ">>>>>>> upstream\n"
+)
+
+// Merge3 does a line-based three-way merge of local and upstream
+// changes made on top of base.  Regions where both sides changed the
+// same lines differently are left with git-style conflict markers
+// and conflict is set to true.
+func Merge3(base, local, upstream string) (merged string, conflict bool) {
+	b, l, u := splitLines(base), splitLines(local), splitLines(upstream)
+	ml, mu := matchLines(b, l), matchLines(b, u)
+
+	var result strings.Builder
+	write := func(lines []string) {
+		for _, line := range lines {
+			result.WriteString(line)
+		}
+	}
+
+	i, x, y := 0, 0, 0
+	for {
+		if i < len(b) && ml[i] == x && mu[i] == y {
+			write(b[i : i+1])
+			i, x, y = i+1, x+1, y+1
+			continue
+		}
+
+		j := i
+		for j < len(b) && (ml[j] < 0 || mu[j] < 0) {
+			j++
+		}
+		xend, yend := len(l), len(u)
+		if j < len(b) {
+			xend, yend = ml[j], mu[j]
+		}
+
+		bc, lc, uc := b[i:j], l[x:xend], u[y:yend]
+		switch {
+		case equalLines(lc, bc):
+			write(uc)
+		case equalLines(uc, bc), equalLines(lc, uc):
+			write(lc)
+		default:
+			conflict = true
+			result.WriteString(conflictLocal)
+			write(terminated(lc))
+			result.WriteString(conflictSep)
+			write(terminated(uc))
+			result.WriteString(conflictUpstream)
+		}
+
+		if j == len(b) {
+			return result.String(), conflict
+		}
+		i, x, y = j, xend, yend
+	}
+}
+
+// writeMerged writes data to the file, preserving any local edits
+// made since the last time stencil wrote the file.  Conflicts are
+// resolved using the strategy of the file (see ResolveConflicts) and
+// if none is provided, the conflict markers are left in the file.
+// It returns true if the merge left conflict markers in the file.
+//
+// Files with unresolved conflicts from a previous run are not
+// modified.  Managed files written before base files were kept have
+// no merge base and take the new output, as they did before, with a
+// warning if that replaces local edits.
+func (s *Stencil) writeMerged(f *FileObj, data []byte) (bool, error) {
+	path := filepath.Clean(f.Loc)
+	basePath := filepath.Join(baseDir, path)
+
+	if s.Before.Conflicts[path] {
+		s.Printf("CONFLICT: skipping %s, see stencil resolve\n", path)
+		s.Objects.addConflict(path)
+		f.Digest = s.Before.fileDigest(path)
+		return true, nil
+	}
+
+	merged, conflict := data, false
+	local, err := s.Read(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return false, err
+	default:
+		base, err := s.Read(basePath)
+		if os.IsNotExist(err) && s.Before.hasFile(path) {
+			base, err = local, nil
+			if digest := s.Before.fileDigest(path); Digest(local) != digest && !bytes.Equal(local, data) {
+				s.Printf("WARNING: no merge base for %s, replacing it with the new output\n", path)
+			}
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		str, c := Merge3(string(base), string(local), string(data))
+		if c && f.Strategy != "" {
+			if str, err = ResolveConflicts(str, f.Strategy); err != nil {
+				return false, err
+			}
+			c = false
+		}
+		merged, conflict = []byte(str), c
+	}
+
+	if err := s.Write(path, merged, 0666); err != nil {
+		return false, err
+	}
+	f.Digest = Digest(data)
+	if conflict {
+		s.Printf("CONFLICT: merge conflict in %s\n", path)
+		s.Objects.addConflict(path)
+	}
+	return conflict, s.Write(basePath, data, 0666)
+}
+
+func splitLines(s string) []string {
+	lines := []string{}
+	for s != "" {
+		idx := strings.Index(s, "\n") + 1
+		if idx == 0 {
+			idx = len(s)
+		}
+		lines = append(lines, s[:idx])
+		s = s[idx:]
+	}
+	return lines
+}
+
+func terminated(lines []string) []string {
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines = append(append([]string{}, lines[:n-1]...), lines[n-1]+"\n")
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for kk := range a {
+		if a[kk] != b[kk] {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLines returns, for every line of a, the index of the matching
+// line in b as per the longest common subsequence or -1 if the line
+// is not part of it.
+func matchLines(a, b []string) []int {
+	result := make([]int, len(a))
+	for kk := range result {
+		result[kk] = -1
+	}
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		result[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		result[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int32, len(a)+1)
+	for kk := range lcs {
+		lcs[kk] = make([]int32, len(b)+1)
+	}
+	for ii := len(a) - 1; ii >= 0; ii-- {
+		for jj := len(b) - 1; jj >= 0; jj-- {
+			switch {
+			case a[ii] == b[jj]:
+				lcs[ii][jj] = lcs[ii+1][jj+1] + 1
+			case lcs[ii+1][jj] >= lcs[ii][jj+1]:
+				lcs[ii][jj] = lcs[ii+1][jj]
+			default:
+				lcs[ii][jj] = lcs[ii][jj+1]
+			}
+		}
+	}
+
+	for ii, jj := 0, 0; ii < len(a) && jj < len(b); {
+		switch {
+		case a[ii] == b[jj]:
+			result[prefix+ii] = prefix + jj
+			ii++
+			jj++
+		case lcs[ii+1][jj] >= lcs[ii][jj+1]:
+			ii++
+		default:
+			jj++
+		}
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package stencil_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestMerge3(t *testing.T) {
+	cases := []struct {
+		name, base, local, upstream, merged string
+		conflict                            bool
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", false},
+		{"local only", "a\nb\n", "a\nx\nb\n", "a\nb\n", "a\nx\nb\n", false},
+		{"upstream only", "a\nb\n", "a\nb\n", "a\nb\nc\n", "a\nb\nc\n", false},
+		{"both", "a\nb\nc\n", "x\nb\nc\n", "a\nb\ny\n", "x\nb\ny\n", false},
+		{"same change", "a\nb\n", "a\nc\n", "a\nc\n", "a\nc\n", false},
+		{"no base", "", "a\n", "a\n", "a\n", false},
+		{
+			"conflict", "a\nb\nc\n", "a\nx\nc\n", "a\ny\nc\n",
+			"a\n<<<<<<< local\nx\n=======\ny\n>>>>>>> upstream\nc\n", true,
+		},
+		{
+			"no newline", "a", "b", "c",
+			"<<<<<<< local\nb\n=======\nc\n>>>>>>> upstream\n", true,
+		},
+	}
+
+	for _, c := range cases {
+		merged, conflict := stencil.Merge3(c.base, c.local, c.upstream)
+		if merged != c.merged || conflict != c.conflict {
+			t.Errorf("%s: got %q %v, expected %q %v", c.name, merged, conflict, c.merged, c.conflict)
+		}
+	}
+}
+
+func TestCopyFileMerge(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.CopyFile "f" "out.txt" "source" }}`,
+		"source": "one\ntwo\nthree\n",
+	}
+	discard := discardLogger{}
+	if err := stencil.New(discard, discard, nil, fs).Run("recipe"); err != nil {
+		t.Fatal("Run", err)
+	}
+
+	fs["out.txt"] = "one\ntwo\nthree\nlocal\n"
+	fs["source"] = "zero\none\ntwo\nthree\n"
+	if err := stencil.New(discard, discard, nil, fs).Run("recipe"); err != nil {
+		t.Fatal("Run", err)
+	}
+
+	if x := fs["out.txt"]; x != "zero\none\ntwo\nthree\nlocal\n" {
+		t.Errorf("Unexpected merge %q", x)
+	}
+	if x := fs[".stencil/base/out.txt"]; x != fs["source"] {
+		t.Errorf("Unexpected base %q", x)
+	}
+}
+
+func TestMergeUpgrade(t *testing.T) {
+	objects := `{"Pulls": {"recipe": true}, "Files": {"f": {"Loc": "out.txt", "URL": "source"}, "g": {"Loc": "g.txt", "URL": "g"}}}`
+	fs := memFS{
+		"recipe":                `{{ stencil.CopyFile "f" "out.txt" "source" }}{{ stencil.CopyFile "g" "g.txt" "g" }}`,
+		"source":                "one\ntwo\n",
+		"g":                     "new\n",
+		"out.txt":               "one\ntwo\nlocal\n",
+		"g.txt":                 "old\n",
+		".stencil/objects.json": objects,
+	}
+	discard := discardLogger{}
+	main := func() {
+		t.Helper()
+		s := stencil.New(discard, discard, nil, fs)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "sync"}); err != nil {
+			t.Fatal("sync", err)
+		}
+	}
+
+	main()
+	if x := fs["out.txt"]; x != "one\ntwo\n" {
+		t.Errorf("Unexpected merge %q", x)
+	}
+	if x := fs["g.txt"]; x != "new\n" {
+		t.Errorf("Unexpected merge %q", x)
+	}
+
+	// later syncs merge against the new base.
+	fs["g.txt"] = "new\nlocal\n"
+	fs["g"] = "zero\nnew\n"
+	main()
+	if x := fs["g.txt"]; x != "zero\nnew\nlocal\n" {
+		t.Errorf("Unexpected merge %q", x)
+	}
+}
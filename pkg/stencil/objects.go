@@ -1,48 +1,109 @@
 package stencil
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"os"
 	"path/filepath"
 )
 
 // FileObj tracks a single file copied locally.
+//
+// Pull is the recipe that copied the file and Digest is the digest
+// of the contents last written by stencil.
 type FileObj struct {
-	Loc, URL string
+	Loc, URL, Pull string
+	Digest         string
+	Strategy       string `json:",omitempty"`
 }
 
 // FileArchiveObj tracks an archive.
+//
+// Digests holds the digest of every file extracted from the archive,
+// keyed by the local path.
 type FileArchiveObj struct {
 	Many           bool
 	Loc, URL, File string
+	Pull           string
+	Digests        map[string]string
 }
 
 // Objects tracks a collection of objects
+//
+// Pulls maps every recipe to true if it was pulled explicitly or to
+// false if it is only pulled as a dependency of other recipes.  Deps
+// maps every recipe to the recipes it depends on.
+//
+// Instances maps the names of recipe instances (pulled via --as) to
+// the url of the recipe.  The instance name is used in place of the
+// url in Pulls and the keys and variables of an instance are prefixed
+// with "name:".
+//
+// Sources records where the value of every variable came from, such
+// as "prompt", "--var" or "global".  Previous holds the values
+// removed by vars unset in the form used with --var, so that they
+// start out as the answer when the variables are asked for again.
 type Objects struct {
 	*Stencil     `json:"-"`
 	Before       *Objects `json:"-"`
 	Pulls        map[string]bool
+	Deps         map[string][]string
+	Instances    map[string]string `json:",omitempty"`
 	Files        map[string]*FileObj
 	FileArchives map[string]*FileArchiveObj
-	Bools        map[string]bool
-	Strings      map[string]string
+	Bools        map[string]bool              `json:",omitempty"`
+	Strings      map[string]string            `json:",omitempty"`
+	Ints         map[string]int               `json:",omitempty"`
+	Lists        map[string][]string          `json:",omitempty"`
+	Maps         map[string]map[string]string `json:",omitempty"`
+	Definitions  map[string]*VarDef           `json:",omitempty"`
+	Sources      map[string]string            `json:",omitempty"`
+	Previous     map[string]string            `json:",omitempty"`
+	Conflicts    map[string]bool
+
+	strategies map[string]string
+	pull       string
+	pulling    []string
+	pulled     map[string]bool
 }
 
 // LoadObjects loads all the objects from the .stencil directory.
+// The pulls and variables come from the manifest (see Manifest) but
+// older workspaces without a manifest have them in objects.json.
 func (o *Objects) LoadObjects() error {
 	data, err := o.Read(".stencil/objects.json")
 	if err == nil {
-		return json.Unmarshal(data, o.Before)
+		err = json.Unmarshal(data, o.Before)
 	}
-	if os.IsNotExist(err) {
-		return nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
-	return err
+	return o.loadManifest()
 }
 
-// SaveObjects saves all the objects to the .stencil directory.
+// SaveObjects saves the manifest and the rest of the objects to the
+// .stencil directory.
 func (o *Objects) SaveObjects() error {
-	data, err := json.MarshalIndent(o, "", "  ") //nolint: staticcheck
+	data, err := json.MarshalIndent(o.manifest(), "", "  ") //nolint: staticcheck
+	if err != nil {
+		return err
+	}
+	if err := o.Write(manifestFile, data, 0666); err != nil {
+		return err
+	}
+
+	// the explicit pulls, instances and values are in the manifest
+	state := *o
+	state.Pulls = map[string]bool{}
+	for pull, explicit := range o.Pulls {
+		if !explicit {
+			state.Pulls[pull] = false
+		}
+	}
+	state.Instances, state.Bools, state.Strings = nil, nil, nil
+	state.Ints, state.Lists, state.Maps = nil, nil, nil
+	data, err = json.MarshalIndent(&state, "", "  ") //nolint: staticcheck
 	if err != nil {
 		return err
 	}
@@ -50,31 +111,254 @@ func (o *Objects) SaveObjects() error {
 	return o.Write(".stencil/objects.json", data, 0666)
 }
 
-func (o *Objects) addPull(url string) {
-	o.Pulls[url] = true
+// restore copies the objects loaded by LoadObjects into the current
+// set.  This is used by commands that update the objects without
+// running any recipes.
+func (o *Objects) restore() {
+	for k, v := range o.Before.Pulls {
+		o.Pulls[k] = v
+	}
+	for k, v := range o.Before.Deps {
+		o.Deps[k] = v
+	}
+	for k, v := range o.Before.Instances {
+		o.Instances[k] = v
+	}
+	for k, v := range o.Before.Files {
+		o.Files[k] = v
+	}
+	for k, v := range o.Before.FileArchives {
+		o.FileArchives[k] = v
+	}
+	for k, v := range o.Before.Bools {
+		o.Bools[k] = v
+	}
+	for k, v := range o.Before.Strings {
+		o.Strings[k] = v
+	}
+	for k, v := range o.Before.Ints {
+		o.Ints[k] = v
+	}
+	for k, v := range o.Before.Lists {
+		o.Lists[k] = v
+	}
+	for k, v := range o.Before.Maps {
+		o.Maps[k] = v
+	}
+	for k, v := range o.Before.Definitions {
+		o.Definitions[k] = v
+	}
+	for k, v := range o.Before.Sources {
+		o.Sources[k] = v
+	}
+	for k, v := range o.Before.Previous {
+		o.Previous[k] = v
+	}
+	for k, v := range o.Before.Conflicts {
+		o.Conflicts[k] = v
+	}
+}
+
+func (o *Objects) addPull(url string, explicit bool) {
+	o.Pulls[url] = o.Pulls[url] || explicit
+}
+
+// addInstance adds a named instance of a recipe.
+func (o *Objects) addInstance(name, url string) {
+	o.Instances[name] = url
+	o.addPull(name, true)
+}
+
+// source returns the url of the recipe of a pull.
+func (o *Objects) source(pull string) string {
+	if url, ok := o.Instances[pull]; ok {
+		return url
+	}
+	return pull
+}
+
+// scope returns the name used for a key or variable of the current
+// pull, which is prefixed with the instance name for instances.
+func (o *Objects) scope(name string) string {
+	if _, ok := o.Instances[o.pull]; ok {
+		return o.pull + ":" + name
+	}
+	return name
+}
+
+func (o *Objects) addDep(pull, dep string) {
+	o.addPull(dep, false)
+	for _, d := range o.Deps[pull] {
+		if d == dep {
+			return
+		}
+	}
+	o.Deps[pull] = append(o.Deps[pull], dep)
+}
+
+func (o *Objects) addFile(key, dest, url, strategy string) *FileObj {
+	f := &FileObj{Loc: dest, URL: url, Pull: o.pull, Strategy: strategy}
+	o.Files[o.scope(key)] = f
+	return f
+}
+
+// getVar returns the value of a variable of the provided type.
+// Choices are stored along with strings.
+func (o *Objects) getVar(name, typ string) (interface{}, bool) {
+	var val interface{}
+	ok := false
+	switch typ {
+	case TypeBool:
+		val, ok = o.Bools[name]
+	case TypeString, TypeChoice:
+		val, ok = o.Strings[name]
+	case TypeInt:
+		val, ok = o.Ints[name]
+	case TypeList:
+		val, ok = o.Lists[name]
+	case TypeMap:
+		val, ok = o.Maps[name]
+	}
+	return val, ok
+}
+
+func (o *Objects) unsetVar(name string) {
+	delete(o.Bools, name)
+	delete(o.Strings, name)
+	delete(o.Ints, name)
+	delete(o.Lists, name)
+	delete(o.Maps, name)
+	delete(o.Sources, name)
+}
+
+// forgetVar is like unsetVar but keeps the value in Previous.
+func (o *Objects) forgetVar(name string) {
+	for _, typ := range []string{TypeBool, TypeString, TypeInt, TypeList, TypeMap} {
+		if val, ok := o.getVar(name, typ); ok {
+			o.Previous[name] = formatVar(val)
+		}
+	}
+	o.unsetVar(name)
+}
+
+func (o *Objects) setVar(name string, val interface{}, source string) {
+	o.Sources[name] = source
+	switch val := val.(type) {
+	case bool:
+		o.Bools[name] = val
+	case string:
+		o.Strings[name] = val
+	case int:
+		o.Ints[name] = val
+	case []string:
+		o.Lists[name] = val
+	case map[string]string:
+		o.Maps[name] = val
+	}
+}
+
+// varSource returns where the value of a variable came from.  Values
+// without a source were added to the manifest by hand.
+func (o *Objects) varSource(name string) string {
+	if source, ok := o.Sources[name]; ok {
+		return source
+	}
+	return "manifest"
+}
+
+func (o *Objects) addConflict(path string) {
+	o.Conflicts[path] = true
+}
+
+// MergeStrategy sets the default strategy used to resolve merge
+// conflicts for files copied with the provided key.  It must be
+// called before the corresponding copy. See ResolveConflicts for the
+// list of strategies.
+func (o *Objects) MergeStrategy(key, strategy string) error {
+	if _, err := ResolveConflicts("", strategy); err != nil {
+		return err
+	}
+	if o.strategies == nil {
+		o.strategies = map[string]string{}
+	}
+	o.strategies[o.scope(key)] = strategy
+	return nil
 }
 
-func (o *Objects) addFile(key, dest, url string) {
-	o.Files[key] = &FileObj{dest, url}
+// strategy returns the merge strategy set for a key.
+func (o *Objects) strategy(key string) string {
+	return o.strategies[o.scope(key)]
 }
 
-func (o *Objects) addArchiveFile(key, dest, url, file string) {
-	o.FileArchives[key] = &FileArchiveObj{false, dest, url, file}
+func (o *Objects) addArchiveFile(key, dest, url, file string) *FileArchiveObj {
+	f := &FileArchiveObj{false, dest, url, file, o.pull, map[string]string{}}
+	o.FileArchives[o.scope(key)] = f
+	return f
 }
 
-func (o *Objects) addArchiveGlob(key, dest, url, glob string) {
-	o.FileArchives[key] = &FileArchiveObj{true, dest, url, glob}
+func (o *Objects) addArchiveGlob(key, dest, url, glob string) *FileArchiveObj {
+	f := &FileArchiveObj{true, dest, url, glob, o.pull, map[string]string{}}
+	o.FileArchives[o.scope(key)] = f
+	return f
+}
+
+// hasFile returns true if a file was copied to the provided local
+// path.
+func (o *Objects) hasFile(path string) bool {
+	for _, f := range o.Files {
+		if filepath.Clean(f.Loc) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDigest returns the last recorded digest of a file copied to
+// the provided local path.
+func (o *Objects) fileDigest(path string) string {
+	for _, f := range o.Files {
+		if filepath.Clean(f.Loc) == path {
+			return f.Digest
+		}
+	}
+	return ""
+}
+
+// Digest returns the digest used to track file contents.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
 }
 
 func (o *Objects) existsArchiveFile(key, dest, url, file string) bool {
-	if f, ok := o.FileArchives[key]; ok && !f.Many {
+	if f, ok := o.FileArchives[o.scope(key)]; ok && !f.Many {
 		return f.Loc == dest && f.URL == url && f.File == file
 	}
 	return false
 }
 
+// unchangedArchive returns true if the previous run extracted the
+// same files from the same archive and none of them were modified or
+// removed since, in which case the recorded digests are reused.
+func (o *Objects) unchangedArchive(key string, obj *FileArchiveObj) bool {
+	prev, ok := o.Before.FileArchives[o.scope(key)]
+	if !ok || len(prev.Digests) == 0 || prev.Many != obj.Many ||
+		prev.Loc != obj.Loc || prev.URL != obj.URL || prev.File != obj.File {
+		return false
+	}
+	for path, digest := range prev.Digests {
+		if data, err := o.Read(path); err != nil || Digest(data) != digest {
+			return false
+		}
+	}
+	for path, digest := range prev.Digests {
+		obj.Digests[path] = digest
+	}
+	return true
+}
+
 func (o *Objects) existsArchiveGlob(key, dest, url, file string) bool {
-	if f, ok := o.FileArchives[key]; ok && f.Many {
+	if f, ok := o.FileArchives[o.scope(key)]; ok && f.Many {
 		return f.Loc == dest && f.URL == url && f.File == file
 	}
 	return false
@@ -100,7 +384,11 @@ func (o *Objects) GC() error {
 	})
 
 	for file := range files {
-		if err := o.Remove(file); err != nil {
+		if err := o.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		err := o.Remove(filepath.Join(baseDir, file))
+		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
 	}
@@ -0,0 +1,189 @@
+package stencil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The kinds of changes recorded by Plan.
+const (
+	OpCreate   = "create"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpDownload = "download"
+)
+
+// Change is a single change recorded by Plan.  URL is only set for
+// downloads.
+type Change struct {
+	Op, Path, URL string
+}
+
+// Plan is a FileSystem that records all changes in memory instead of
+// applying them to the underlying FileSystem.  Reads see the recorded
+// changes.
+//
+// Changes to the .stencil directory are not reported.  Archives are
+// not downloaded unless Fetch is set, in which case the extracted
+// files are also kept in memory.
+type Plan struct {
+	FileSystem
+	Changes []Change
+	Fetch   bool
+
+	files   map[string][]byte
+	removed map[string]bool
+	seen    map[string]bool
+}
+
+// NewPlan creates a plan on top of the provided file system.
+func NewPlan(fs FileSystem) *Plan {
+	return &Plan{
+		FileSystem: fs,
+		Changes:    []Change{},
+		files:      map[string][]byte{},
+		removed:    map[string]bool{},
+		seen:       map[string]bool{},
+	}
+}
+
+// Read reads a file, taking into account all recorded changes.
+func (p *Plan) Read(path string) ([]byte, error) {
+	if isRemote(path) {
+		return p.FileSystem.Read(path)
+	}
+
+	clean := filepath.Clean(path)
+	if data, ok := p.files[clean]; ok {
+		return data, nil
+	}
+	if p.isRemoved(clean) {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return p.FileSystem.Read(path)
+}
+
+// Write records a file write.  Writes that do not change the contents
+// of the file are not reported.
+func (p *Plan) Write(path string, data []byte, mode os.FileMode) error {
+	clean := filepath.Clean(path)
+	existing, err := p.Read(clean)
+	switch {
+	case os.IsNotExist(err):
+		p.record(Change{Op: OpCreate, Path: clean})
+	case err != nil || !bytes.Equal(existing, data):
+		p.record(Change{Op: OpUpdate, Path: clean})
+	}
+
+	p.files[clean] = append([]byte(nil), data...)
+	return nil
+}
+
+// Remove records a file deletion.
+func (p *Plan) Remove(path string) error {
+	clean := filepath.Clean(path)
+	if _, err := p.Read(clean); err != nil {
+		return err
+	}
+
+	p.record(Change{Op: OpDelete, Path: clean})
+	delete(p.files, clean)
+	p.removed[clean] = true
+	return nil
+}
+
+// RemoveAll records the deletion of a directory.
+func (p *Plan) RemoveAll(path string) error {
+	clean := filepath.Clean(path)
+	p.record(Change{Op: OpDelete, Path: clean})
+	for file := range p.files {
+		if strings.HasPrefix(file, clean+string(filepath.Separator)) {
+			delete(p.files, file)
+		}
+	}
+	p.removed[clean] = true
+	return nil
+}
+
+// Download records the download of an archive at url into path.  It
+// returns false (i.e. skip the download) unless Fetch is set.  It is
+// not called for archives whose extracted files are unchanged since
+// the last sync, so those are neither reported nor fetched.
+func (p *Plan) Download(url, path string) bool {
+	p.record(Change{Op: OpDownload, Path: filepath.Clean(path), URL: url})
+	return p.Fetch
+}
+
+// Pinnable forwards to the underlying file system if it supports
+// pinning.
+func (p *Plan) Pinnable(path string) bool {
+	pp, ok := p.FileSystem.(pinner)
+	return ok && pp.Pinnable(path)
+}
+
+// Resolve forwards to the underlying file system if it supports
+// pinning.
+func (p *Plan) Resolve(path string) (string, error) {
+	if pp, ok := p.FileSystem.(pinner); ok {
+		return pp.Resolve(path)
+	}
+	return "", errors.New("cannot resolve " + path)
+}
+
+// Pin forwards to the underlying file system if it supports pinning.
+func (p *Plan) Pin(path, hash string) (string, bool) {
+	if pp, ok := p.FileSystem.(pinner); ok {
+		return pp.Pin(path, hash)
+	}
+	return "", false
+}
+
+// JSON returns the changes as JSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p.Changes, "", "  ")
+}
+
+// Print prints the changes in a human readable form.
+func (p *Plan) Print(w io.Writer) {
+	if len(p.Changes) == 0 {
+		fmt.Fprintf(w, "No changes\n")
+	}
+	for _, c := range p.Changes {
+		if c.Op == OpDownload {
+			fmt.Fprintf(w, "%-8s %s (from %s)\n", c.Op, c.Path, c.URL)
+		} else {
+			fmt.Fprintf(w, "%-8s %s\n", c.Op, c.Path)
+		}
+	}
+}
+
+func (p *Plan) record(c Change) {
+	if c.Path == ".stencil" || strings.HasPrefix(c.Path, ".stencil"+string(filepath.Separator)) {
+		return
+	}
+	key := c.Path
+	if c.Op == OpDownload {
+		key = c.Op + " " + key
+	}
+	if !p.seen[key] {
+		p.seen[key] = true
+		p.Changes = append(p.Changes, c)
+	}
+}
+
+func (p *Plan) isRemoved(path string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if p.removed[dir] {
+			return true
+		}
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
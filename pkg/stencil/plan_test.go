@@ -0,0 +1,93 @@
+package stencil_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestDryRun(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.CopyFile "a" "a.txt" "source" }}
+{{ stencil.CopyFile "b" "b.txt" "source" }}
+{{ stencil.CopyFromArchive "c" "bin/c" "https://example.com/c.zip" "c" }}`,
+		"source": "hello\n",
+	}
+	discard := discardLogger{}
+	main := func(args ...string) ([]stencil.Change, error) {
+		var buf bytes.Buffer
+		s := stencil.New(discard, discard, nil, fs)
+		s.Stdout = &buf
+		args = append([]string{"stencil", "--dry-run", "--json"}, args...)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args); err != nil {
+			return nil, err
+		}
+		var changes []stencil.Change
+		return changes, json.Unmarshal(buf.Bytes(), &changes)
+	}
+
+	fs["a.txt"] = "hello\n"
+	changes, err := main("pull", "recipe")
+	if err != nil {
+		t.Fatal("pull", err)
+	}
+
+	expected := []stencil.Change{
+		{Op: stencil.OpCreate, Path: "b.txt"},
+		{Op: stencil.OpDownload, Path: "bin/c", URL: "https://example.com/c.zip"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Error("Unexpected changes", changes)
+	}
+	if _, ok := fs["b.txt"]; ok {
+		t.Error("Dry run wrote b.txt")
+	}
+	if _, ok := fs[".stencil/objects.json"]; ok {
+		t.Error("Dry run saved objects")
+	}
+
+	fs[".stencil/objects.json"] = `{"Pulls": {"recipe": true}, "Files": {"a": {"Loc": "a.txt"}}}`
+	changes, err = main("rm", "recipe")
+	if err != nil {
+		t.Fatal("rm", err)
+	}
+
+	expected = []stencil.Change{{Op: stencil.OpDelete, Path: "a.txt"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Error("Unexpected changes", changes)
+	}
+	if _, ok := fs["a.txt"]; !ok {
+		t.Error("Dry run removed a.txt")
+	}
+}
+
+func TestDryRunArchives(t *testing.T) {
+	fs := memFS{
+		"recipe":                `{{ stencil.CopyFromArchive "c" "bin/c" "https://example.com/c.zip" "c" }}`,
+		".stencil/objects.json": `{"Pulls": {"recipe": true}, "FileArchives": {"c": {"Loc": "bin/c", "URL": "https://example.com/c.zip", "File": "c", "Digests": {"bin/c": "` + stencil.Digest([]byte("c")) + `"}}}}`,
+		"bin/c":                 "c",
+	}
+	discard := discardLogger{}
+	main := func() string {
+		var buf bytes.Buffer
+		s := stencil.New(discard, discard, nil, fs)
+		s.Stdout = &buf
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "--dry-run", "sync"}); err != nil {
+			t.Fatal("sync", err)
+		}
+		return buf.String()
+	}
+
+	if out := main(); out != "No changes\n" {
+		t.Error("Unexpected", out)
+	}
+	fs["bin/c"] = "modified"
+	if out := main(); !strings.Contains(out, "download bin/c") {
+		t.Error("Unexpected", out)
+	}
+}
@@ -2,31 +2,65 @@ package stencil
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
+// Question is a prompt for the value of a variable.  Previous is the
+// earlier answer, if any, such as a value removed by vars unset, in
+// the form used with --var.  Check returns an error if the answer is
+// not a valid value.
+type Question struct {
+	Name, Previous string
+	*VarDef
+	Check func(answer string) error
+}
+
+// QuestionPrompter is implemented by prompters which can ask for
+// variables of any type, presenting the choices of choice variables
+// as a menu and asking again when an answer is not valid.
+type QuestionPrompter interface {
+	Ask(q *Question) (string, error)
+}
+
+// FormPrompter is implemented by prompters which can ask several
+// questions at once, such as a form with a confirmation screen.  The
+// answers are returned in the order of the questions.
+type FormPrompter interface {
+	AskAll(questions []*Question) ([]string, error)
+}
+
+// SecretPrompter is implemented by prompters which can prompt for
+// a secret without echoing it.
+type SecretPrompter interface {
+	PromptSecret(prompt string) (string, error)
+}
+
 // ConsolePrompt implements the prompter interface.
 type ConsolePrompt struct {
 	Stdin  io.Reader
 	Stdout io.Writer
+
+	scanner *bufio.Scanner
 }
 
 // Bool prompts for and fetches a bool.
 func (c *ConsolePrompt) PromptBool(prompt string) (bool, error) {
 	for {
-		var s string
 		fmt.Fprintf(c.Stdout, "%s (Yes/No/True/False)? ", prompt)
-		if _, err := fmt.Fscanln(c.Stdin, &s); err != nil {
+		s, err := c.readLine()
+		if err != nil {
 			return false, err
 		}
 
-		switch strings.ToLower(s) {
-		case "t", "true", "y", "yes":
-			return true, nil
-		case "f", "false", "n", "no":
-			return false, nil
+		if val, err := parseBool(s); err == nil {
+			return val, nil
 		}
 	}
 }
@@ -34,7 +68,67 @@ func (c *ConsolePrompt) PromptBool(prompt string) (bool, error) {
 // String prompts for and fetches a string.
 func (c *ConsolePrompt) PromptString(prompt string) (string, error) {
 	fmt.Fprintf(c.Stdout, "%s? ", prompt)
-	scanner := bufio.NewScanner(c.Stdin)
-	scanner.Scan()
-	return strings.TrimSpace(scanner.Text()), scanner.Err()
+	return c.readLine()
+}
+
+// Ask prompts for a variable until the answer is valid.  Choices are
+// listed as a numbered menu and can be picked by number or by value.
+func (c *ConsolePrompt) Ask(q *Question) (string, error) {
+	if q.Help != "" {
+		fmt.Fprintf(c.Stdout, "%s\n", q.Help)
+	}
+	for {
+		fmt.Fprintf(c.Stdout, "%s? ", q.Label())
+		if len(q.Choices) > 0 {
+			fmt.Fprintf(c.Stdout, "\n")
+			for kk, choice := range q.Choices {
+				fmt.Fprintf(c.Stdout, "  %d) %s\n", kk+1, choice)
+			}
+			fmt.Fprintf(c.Stdout, "> ")
+		}
+
+		answer, err := c.readLine()
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n > 0 && n <= len(q.Choices) {
+			answer = q.Choices[n-1]
+		}
+
+		err = q.Check(answer)
+		if err == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(c.Stdout, "Invalid answer: %v\n", err)
+	}
+}
+
+// PromptSecret prompts for a string without echoing it if Stdin is
+// a terminal.
+func (c *ConsolePrompt) PromptSecret(prompt string) (string, error) {
+	fmt.Fprintf(c.Stdout, "%s? ", prompt)
+	f, ok := c.Stdin.(*os.File)
+	if !ok || !terminal.IsTerminal(int(f.Fd())) {
+		return c.readLine()
+	}
+
+	data, err := terminal.ReadPassword(int(f.Fd()))
+	fmt.Fprintf(c.Stdout, "\n")
+	return strings.TrimSpace(string(data)), err
+}
+
+// readLine reads a line of input.  Running out of input is an error
+// rather than an empty answer so that blank values are never saved
+// when stdin is closed, as is typical in CI.
+func (c *ConsolePrompt) readLine() (string, error) {
+	if c.scanner == nil {
+		c.scanner = bufio.NewScanner(c.Stdin)
+	}
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("no answer: end of input (use --no-input to list the missing variables)")
+	}
+	return strings.TrimSpace(c.scanner.Text()), nil
 }
@@ -0,0 +1,75 @@
+package stencil
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Pull runs another recipe as a dependency of the recipe being
+// pulled.  Relative urls are resolved against the url of the caller.
+//
+// Each recipe runs at most once per sync, even if it is reached via
+// several pulls.  Dependencies are recorded as transitive pulls in
+// objects.json and their files are removed once no pull depends on
+// them anymore.
+//
+// The output is always empty but it is returned along with the error
+// so that failures abort the calling template.
+func (s *Stencil) Pull(url string) (string, error) {
+	resolved, err := s.resolve(url)
+	if err != nil {
+		return "", s.Errorf("Error resolving %s %v\n", url, err)
+	}
+	url = resolved
+
+	s.Objects.addDep(s.Objects.pull, url)
+	return "", s.runPull(url)
+}
+
+// runPull runs a recipe unless it has already run in this sync.
+func (s *Stencil) runPull(pull string) error {
+	if s.pulled[pull] {
+		return nil
+	}
+	for kk, p := range s.pulling {
+		if p == pull {
+			cycle := append(append([]string{}, s.pulling[kk:]...), pull)
+			return s.Errorf("Pull %v\n", errors.New("pull cycle: "+strings.Join(cycle, " -> ")))
+		}
+	}
+
+	s.Printf("Pulling %s\n", pull)
+	sources, templates, current := s.sources, s.templates, s.Objects.pull
+	s.sources, s.templates, s.Objects.pull = nil, nil, pull
+	s.pulling = append(s.pulling, pull)
+	defer func() {
+		s.sources, s.templates, s.Objects.pull = sources, templates, current
+		s.pulling = s.pulling[:len(s.pulling)-1]
+	}()
+
+	if err := s.Run(s.Objects.source(pull)); err != nil {
+		return err
+	}
+	s.pulled[pull] = true
+	return nil
+}
+
+// runPulls runs all the explicit pulls and their dependencies.
+func (s *Stencil) runPulls() error {
+	s.pulled = map[string]bool{}
+	explicit := []string{}
+	for pull, ok := range s.Pulls {
+		if ok {
+			explicit = append(explicit, pull)
+		}
+	}
+	sort.Strings(explicit)
+
+	for _, pull := range explicit {
+		if err := s.runPull(pull); err != nil {
+			return err
+		}
+	}
+	return nil
+}
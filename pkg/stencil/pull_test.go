@@ -0,0 +1,103 @@
+package stencil_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestPullDependencies(t *testing.T) {
+	fs := memFS{
+		"app.md":    `{{ stencil.Pull "std/a.md" }}{{ stencil.Pull "std/b.md" }}`,
+		"std/a.md":  `{{ stencil.Pull "c.md" }}{{ stencil.CopyFile "a" "a.txt" "a.txt" }}`,
+		"std/b.md":  `{{ stencil.Pull "c.md" }}`,
+		"std/c.md":  `{{ stencil.CopyFile "c" "c.txt" "c.txt" }}`,
+		"std/a.txt": "a",
+		"std/c.txt": "c",
+		"other.md":  `{{ stencil.Pull "std/c.md" }}`,
+	}
+
+	logs := &logLines{}
+	main := func(args ...string) {
+		t.Helper()
+		s := stencil.New(logs, logs, nil, fs)
+		args = append([]string{"stencil"}, args...)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args); err != nil {
+			t.Fatal("Main", args, err)
+		}
+	}
+
+	main("pull", "app.md")
+	if n := logs.count("Pulling std/c.md"); n != 1 {
+		t.Error("Unexpected number of runs", n)
+	}
+	if fs["a.txt"] != "a" || fs["c.txt"] != "c" {
+		t.Error("Unexpected files", fs)
+	}
+
+	var objects struct {
+		Pulls map[string]bool
+		Deps  map[string][]string
+	}
+	if err := json.Unmarshal([]byte(fs[".stencil/objects.json"]), &objects); err != nil {
+		t.Fatal("Unmarshal", err)
+	}
+	pulls := map[string]bool{"std/a.md": false, "std/b.md": false, "std/c.md": false}
+	deps := map[string][]string{
+		"app.md":   {"std/a.md", "std/b.md"},
+		"std/a.md": {"std/c.md"},
+		"std/b.md": {"std/c.md"},
+	}
+	if !reflect.DeepEqual(objects.Pulls, pulls) || !reflect.DeepEqual(objects.Deps, deps) {
+		t.Error("Unexpected objects", fs[".stencil/objects.json"])
+	}
+
+	main("pull", "other.md")
+	main("rm", "app.md")
+	if _, ok := fs["a.txt"]; ok {
+		t.Error("Orphaned dependency was not removed")
+	}
+	if fs["c.txt"] != "c" {
+		t.Error("Shared dependency was removed")
+	}
+
+	main("rm", "other.md")
+	if _, ok := fs["c.txt"]; ok {
+		t.Error("Orphaned dependency was not removed")
+	}
+}
+
+func TestPullCycle(t *testing.T) {
+	fs := memFS{
+		"x.md": `{{ stencil.Pull "y.md" }}`,
+		"y.md": `{{ stencil.Pull "x.md" }}`,
+	}
+
+	discard := discardLogger{}
+	s := stencil.New(discard, discard, nil, fs)
+	err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "x.md"})
+	if err == nil || !strings.Contains(err.Error(), "pull cycle: x.md -> y.md -> x.md") {
+		t.Error("Unexpected", err)
+	}
+}
+
+type logLines []string
+
+func (l *logLines) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func (l *logLines) count(prefix string) int {
+	n := 0
+	for _, line := range *l {
+		if strings.HasPrefix(line, prefix) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,230 @@
+package stencil
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/mod/semver"
+)
+
+// isAbbrevHash returns true for names which look like abbreviated
+// commit hashes.  Only hashes with at least 7 hex digits (the git
+// default) are considered to avoid confusion with branch names.
+func isAbbrevHash(s string) bool {
+	if len(s) < 7 || len(s) >= 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
+
+// isConstraint returns true for semver constraints like ^1.2, ~1.4.0
+// or ">=2.0.0 <3".
+func isConstraint(s string) bool {
+	return strings.ContainsAny(s, "^~<>= ")
+}
+
+// constraint is a set of semver comparisons which must all hold.
+type constraint []struct {
+	op, version string
+}
+
+// parseConstraint parses space separated comparisons.  Each
+// comparison is one of ^v, ~v, >=v, >v, <=v, <v, =v or v where v is a
+// semver with or without the leading "v" and with optional minor and
+// patch versions.
+func parseConstraint(s string) (constraint, error) {
+	result := constraint{}
+	add := func(op, version string) {
+		result = append(result, struct{ op, version string }{op, version})
+	}
+
+	for _, part := range strings.Fields(s) {
+		version := strings.TrimLeft(part, "^~<>=")
+		op := part[:len(part)-len(version)]
+		version = "v" + strings.TrimPrefix(version, "v")
+		if !semver.IsValid(version) {
+			return nil, errors.New("invalid version constraint: " + s)
+		}
+
+		switch op {
+		case "^":
+			add(">=", version)
+			add("<", nextVersion(version, semver.Major(version) == "v0"))
+		case "~":
+			add(">=", version)
+			add("<", nextVersion(version, strings.Count(version, ".") > 0))
+		case ">=", ">", "<=", "<", "=", "":
+			add(op, version)
+		default:
+			return nil, errors.New("invalid version constraint: " + s)
+		}
+	}
+	return result, nil
+}
+
+// nextVersion returns the next major version or the next minor version
+// if minor is set.
+func nextVersion(version string, minor bool) string {
+	parts := strings.Split(strings.TrimPrefix(semver.Canonical(version), "v"), ".")
+	if minor {
+		return "v" + parts[0] + "." + increment(parts[1]) + ".0"
+	}
+	return "v" + increment(parts[0]) + ".0.0"
+}
+
+func increment(digits string) string {
+	b := []byte(digits)
+	for kk := len(b) - 1; kk >= 0; kk-- {
+		if b[kk] < '9' {
+			b[kk]++
+			return string(b)
+		}
+		b[kk] = '0'
+	}
+	return "1" + string(b)
+}
+
+// match returns true if the version satisfies all comparisons.
+// Prerelease versions only match if explicitly mentioned.
+func (c constraint) match(version string) bool {
+	if !semver.IsValid(version) {
+		return false
+	}
+
+	prerelease := semver.Prerelease(version) != ""
+	for _, cmp := range c {
+		if prerelease && semver.Prerelease(cmp.version) == "" {
+			return false
+		}
+		n := semver.Compare(version, cmp.version)
+		switch cmp.op {
+		case ">=":
+			if n < 0 {
+				return false
+			}
+		case ">":
+			if n <= 0 {
+				return false
+			}
+		case "<=":
+			if n > 0 {
+				return false
+			}
+		case "<":
+			if n >= 0 {
+				return false
+			}
+		default:
+			if n != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fetchConstraint fetches the highest tag of the remote which matches
+// the semver constraint.
+func (fs *FS) fetchConstraint(r *git.Repository, s string) (plumbing.Hash, error) {
+	c, err := parseConstraint(s)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	refs, err := fs.listRefs(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var best plumbing.ReferenceName
+	bestVersion := ""
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		version := "v" + strings.TrimPrefix(ref.Name().Short(), "v")
+		if c.match(version) && (bestVersion == "" || semver.Compare(version, bestVersion) > 0) {
+			best, bestVersion = ref.Name(), version
+		}
+	}
+
+	if bestVersion == "" {
+		return plumbing.ZeroHash, errors.New("no tag matches " + s)
+	}
+	return fs.fetchRef(r, best)
+}
+
+// listRefs lists the branches and tags of the remote.
+func (fs *FS) listRefs(r *git.Repository) ([]*plumbing.Reference, error) {
+	remote, err := r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*plumbing.Reference
+	err = fs.withAuth(remote.Config().URLs[0], func(auth transport.AuthMethod) error {
+		refs, err = remote.List(&git.ListOptions{Auth: auth})
+		return err
+	})
+	return refs, err
+}
+
+// fetchHexRef fetches the branch or tag of the remote with the name.
+// Names like deadbeef or cafe1234 look like abbreviated commit hashes,
+// so they are only treated as hashes if no branch or tag matches.
+func (fs *FS) fetchHexRef(r *git.Repository, name string) (plumbing.Hash, error) {
+	refs, err := fs.listRefs(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, ref := range refs {
+		if (ref.Name().IsBranch() || ref.Name().IsTag()) && ref.Name().Short() == name {
+			return fs.fetchRef(r, ref.Name())
+		}
+	}
+	return fs.fetchAbbrevHash(r, name)
+}
+
+// fetchAbbrevHash finds the commit with the abbreviated hash, fetching
+// all branches and tags if it is not in the mirror.
+func (fs *FS) fetchAbbrevHash(r *git.Repository, prefix string) (plumbing.Hash, error) {
+	hash, err := fs.findAbbrevHash(r, prefix)
+	if err != nil || hash != plumbing.ZeroHash {
+		return hash, err
+	}
+
+	if err := fs.fetchSpecs(r, "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	hash, err = fs.findAbbrevHash(r, prefix)
+	if err == nil && hash == plumbing.ZeroHash {
+		err = errors.New("no commit matches " + prefix)
+	}
+	return hash, err
+}
+
+func (fs *FS) findAbbrevHash(r *git.Repository, prefix string) (plumbing.Hash, error) {
+	iter, err := r.CommitObjects()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	found := plumbing.ZeroHash
+	err = iter.ForEach(func(c *object.Commit) error {
+		if !strings.HasPrefix(c.Hash.String(), strings.ToLower(prefix)) {
+			return nil
+		}
+		if found != plumbing.ZeroHash && found != c.Hash {
+			return errors.New("ambiguous commit hash " + prefix)
+		}
+		found = c.Hash
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,62 @@
+package stencil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestGitRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := newGitRepo(t, filepath.Join(dir, "repo.git"))
+	hashes := map[string]string{}
+	for _, tag := range []string{"v1.0.0", "v1.2.0", "v1.2.5", "v1.3.0", "v2.0.0", "v2.1.0-rc1"} {
+		repo.commit("f.txt", tag)
+		repo.git(repo.src, "tag", tag)
+		repo.git(repo.src, "push", "-q", repo.dir, tag)
+		hashes[tag] = strings.TrimSpace(repo.git(repo.src, "rev-parse", "HEAD"))
+	}
+
+	repo.commit("f.txt", "deadbeef")
+	repo.git(repo.src, "push", "-q", repo.dir, "HEAD:refs/heads/deadbeef")
+	repo.git(repo.src, "push", "-q", "-f", repo.dir, "v2.1.0-rc1^{commit}:refs/heads/master")
+	repo.git(repo.src, "tag", "cafe1234", "v1.2.0")
+	repo.git(repo.src, "push", "-q", repo.dir, "cafe1234")
+
+	discard := discardLogger{}
+	fs := &stencil.FS{CacheDir: filepath.Join(dir, "cache"), Verbose: discard, Errorl: discard}
+	cases := map[string]string{
+		"v1.2.0":              "v1.2.0",
+		"^1.2":                "v1.3.0",
+		"~1.2.0":              "v1.2.5",
+		">=2.0.0 <3":          "v2.0.0",
+		"<=1.2":               "v1.2.0",
+		hashes["v1.0.0"]:      "v1.0.0",
+		hashes["v1.2.5"][:10]: "v1.2.5",
+		"master":              "v2.1.0-rc1",
+		"deadbeef":            "deadbeef",
+		"cafe1234":            "v1.2.0",
+		">=2.1.0-rc1":         "v2.1.0-rc1",
+		"^0.1 || garbage":     "",
+		"^3":                  "",
+		hashes["v1.0.0"][:6]:  "",
+	}
+	for ref, expected := range cases {
+		data, err := fs.Read("git://" + repo.dir + "#" + ref + "/f.txt")
+		if expected == "" && err == nil {
+			t.Errorf("%s: unexpected success %q", ref, data)
+		}
+		if expected != "" && (err != nil || string(data) != expected) {
+			t.Errorf("%s: got %q %v, expected %s", ref, data, err, expected)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package stencil
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResolveConflicts removes the conflict markers left by a three-way
+// merge using the provided strategy:
+//
+//	ours   -- keep the local side of every conflict
+//	theirs -- keep the upstream side of every conflict
+//	union  -- keep the local side followed by the upstream side
+//
+// Changes outside of the conflicted regions are preserved.
+func ResolveConflicts(text, strategy string) (string, error) {
+	var ours, theirs bool
+	switch strategy {
+	case "ours":
+		ours = true
+	case "theirs":
+		theirs = true
+	case "union":
+		ours, theirs = true, true
+	default:
+		return "", errors.New("unknown merge strategy: " + strategy)
+	}
+
+	var result strings.Builder
+	inLocal, inUpstream := false, false
+	for _, line := range splitLines(text) {
+		switch {
+		case !inLocal && !inUpstream && strings.HasPrefix(line, "<<<<<<< "):
+			inLocal = true
+		case inLocal && strings.TrimRight(line, "\r\n") == "=======":
+			inLocal, inUpstream = false, true
+		case inUpstream && strings.HasPrefix(line, ">>>>>>> "):
+			inUpstream = false
+		case inLocal && !ours, inUpstream && !theirs:
+		default:
+			result.WriteString(line)
+		}
+	}
+
+	if inLocal || inUpstream {
+		return "", errors.New("unterminated conflict marker")
+	}
+	return result.String(), nil
+}
+
+// Resolve lists the files with merge conflicts if path is empty.
+// Otherwise, it resolves the conflicts in the file using the provided
+// strategy.  An empty strategy marks a hand-edited file as resolved.
+func (s *Stencil) Resolve(path, strategy string) error {
+	if err := s.Objects.LoadObjects(); err != nil {
+		return s.Errorf("LoadObjects %v\n", err)
+	}
+	s.Objects.restore()
+
+	if path == "" {
+		paths := []string{}
+		for path := range s.Conflicts {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			s.Printf("conflict: %s\n", path)
+		}
+		return nil
+	}
+
+	path = filepath.Clean(path)
+	if !s.Conflicts[path] {
+		return s.Errorf("resolve %v\n", errors.New("no conflicts in "+path))
+	}
+
+	data, err := s.Read(path)
+	if err != nil {
+		return s.Errorf("resolve %v\n", err)
+	}
+
+	text := string(data)
+	if strategy == "" && hasConflictMarkers(text) {
+		return s.Errorf("resolve %v\n", errors.New(path+" still has conflict markers"))
+	}
+	if strategy != "" {
+		if text, err = ResolveConflicts(text, strategy); err != nil {
+			return s.Errorf("resolve %v\n", err)
+		}
+		if err = s.Write(path, []byte(text), 0666); err != nil {
+			return s.Errorf("resolve %v\n", err)
+		}
+	}
+
+	delete(s.Conflicts, path)
+	return s.SaveObjects()
+}
+
+func hasConflictMarkers(text string) bool {
+	for _, line := range splitLines(text) {
+		if strings.HasPrefix(line, "<<<<<<< ") || strings.HasPrefix(line, ">>>>>>> ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package stencil_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	text := "a\n<<<<<<< local\nx\n=======\ny\n>>>>>>> upstream\nb\n"
+	expected := map[string]string{
+		"ours":   "a\nx\nb\n",
+		"theirs": "a\ny\nb\n",
+		"union":  "a\nx\ny\nb\n",
+	}
+	for strategy, want := range expected {
+		got, err := stencil.ResolveConflicts(text, strategy)
+		if err != nil || got != want {
+			t.Errorf("%s: got %q %v", strategy, got, err)
+		}
+	}
+
+	if _, err := stencil.ResolveConflicts(text, "boo"); err == nil {
+		t.Error("Unexpected success with unknown strategy")
+	}
+	if _, err := stencil.ResolveConflicts("<<<<<<< local\n", "ours"); err == nil {
+		t.Error("Unexpected success with unterminated conflict")
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.CopyFile "f" "out.txt" "source" }}`,
+		"source": "one\n",
+	}
+	discard := discardLogger{}
+	sync := func() {
+		s := stencil.New(discard, discard, nil, fs)
+		if err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipe"}); err != nil {
+			t.Fatal("pull", err)
+		}
+	}
+	resolve := func(args ...string) error {
+		s := stencil.New(discard, discard, nil, fs)
+		args = append([]string{"stencil", "resolve"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	sync()
+	fs["out.txt"] = "local\n"
+	fs["source"] = "upstream\n"
+	sync()
+
+	conflicted := "<<<<<<< local\nlocal\n=======\nupstream\n>>>>>>> upstream\n"
+	if fs["out.txt"] != conflicted {
+		t.Fatalf("Unexpected merge %q", fs["out.txt"])
+	}
+
+	fs["source"] = "upstream2\n"
+	sync()
+	if fs["out.txt"] != conflicted {
+		t.Fatalf("Conflicted file modified %q", fs["out.txt"])
+	}
+
+	if err := resolve("out.txt"); err == nil {
+		t.Error("Unexpected resolve success with conflict markers")
+	}
+	if err := resolve("out.txt", "theirs"); err != nil {
+		t.Fatal("resolve", err)
+	}
+	if fs["out.txt"] != "upstream\n" {
+		t.Errorf("Unexpected resolution %q", fs["out.txt"])
+	}
+	if err := resolve("out.txt", "theirs"); err == nil {
+		t.Error("Unexpected resolve success without conflict")
+	}
+
+	sync()
+	if fs["out.txt"] != "upstream2\n" {
+		t.Errorf("Unexpected sync after resolve %q", fs["out.txt"])
+	}
+}
+
+func TestMergeStrategy(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.MergeStrategy "f" "ours" }}{{ stencil.CopyFile "f" "out.txt" "source" }}`,
+		"source": "one\n",
+	}
+	discard := discardLogger{}
+	if err := stencil.New(discard, discard, nil, fs).Run("recipe"); err != nil {
+		t.Fatal("Run", err)
+	}
+
+	fs["out.txt"] = "local\n"
+	fs["source"] = "two\n"
+	if err := stencil.New(discard, discard, nil, fs).Run("recipe"); err != nil {
+		t.Fatal("Run", err)
+	}
+	if fs["out.txt"] != "local\n" {
+		t.Errorf("Unexpected merge %q", fs["out.txt"])
+	}
+}
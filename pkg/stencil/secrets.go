@@ -0,0 +1,265 @@
+package stencil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// SecretStore stores the values of secret variables outside of the
+// workspace.  Get returns false if there is no value.
+type SecretStore interface {
+	Get(name string) (string, bool, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+// DefaultSecretStore returns the secret store for the workspace in
+// baseDir: the OS keyring if one is available and an encrypted file
+// otherwise.  The passphrase of the file is read from
+// $STENCIL_SECRET_PASSPHRASE or prompted for.
+func DefaultSecretStore(baseDir string, p Prompter) (SecretStore, error) {
+	sum := sha256.Sum256([]byte(baseDir))
+	workspace := hex.EncodeToString(sum[:])
+	if k := (&KeyringStore{Service: "stencil:" + workspace}); k.Available() {
+		return k, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	passphrase := func() (string, error) {
+		if s := os.Getenv("STENCIL_SECRET_PASSPHRASE"); s != "" {
+			return s, nil
+		}
+		if sp, ok := p.(SecretPrompter); ok {
+			return sp.PromptSecret("Passphrase for stencil secrets")
+		}
+		return "", errors.New("set $STENCIL_SECRET_PASSPHRASE to use secrets")
+	}
+	path := filepath.Join(dir, "stencil", "secrets", workspace+".json")
+	return &FileSecretStore{Path: path, Passphrase: passphrase}, nil
+}
+
+// KeyringStore stores secrets in the OS keyring using the security
+// command on macOS and secret-tool (libsecret) elsewhere.
+type KeyringStore struct {
+	Service string
+}
+
+// Available returns true if the keyring command is installed and the
+// keyring can be reached.  Headless sessions often have secret-tool
+// installed but no secret service running (or no default keychain on
+// macOS), so the keyring is probed with a lookup of a missing secret.
+// Such lookups fail silently while an unreachable keyring reports an
+// error.
+func (k *KeyringStore) Available() bool {
+	if _, err := exec.LookPath(k.command()); err != nil {
+		return false
+	}
+
+	args := []string{"lookup", "service", k.Service, "name", "stencil.probe"}
+	if runtime.GOOS == "darwin" {
+		args = []string{"default-keychain"}
+	}
+	_, err := exec.Command(k.command(), args...).Output() //nolint: gosec
+	if exit, ok := err.(*exec.ExitError); ok && runtime.GOOS != "darwin" {
+		return len(exit.Stderr) == 0
+	}
+	return err == nil
+}
+
+func (k *KeyringStore) command() string {
+	if runtime.GOOS == "darwin" {
+		return "security"
+	}
+	return "secret-tool"
+}
+
+// Get returns the secret stored in the keyring.
+func (k *KeyringStore) Get(name string) (string, bool, error) {
+	args := []string{"lookup", "service", k.Service, "name", name}
+	if runtime.GOOS == "darwin" {
+		args = []string{"find-generic-password", "-s", k.Service, "-a", name, "-w"}
+	}
+
+	out, err := exec.Command(k.command(), args...).Output() //nolint: gosec
+	if _, ok := err.(*exec.ExitError); ok || err == nil && len(out) == 0 {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(string(out), "\n"), true, nil
+}
+
+// Set stores a secret in the keyring.  The secret is passed via
+// stdin so that it does not show up in the process list.
+func (k *KeyringStore) Set(name, value string) error {
+	cmd := exec.Command(k.command(), "store", "--label", "stencil "+name, "service", k.Service, "name", name) //nolint: gosec
+	cmd.Stdin = strings.NewReader(value)
+	if runtime.GOOS == "darwin" {
+		quote := func(s string) string {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+		cmd = exec.Command(k.command(), "-i")
+		cmd.Stdin = strings.NewReader("add-generic-password -U -s " + quote(k.Service) +
+			" -a " + quote(name) + " -w " + quote(value) + "\n")
+	}
+	return cmd.Run()
+}
+
+// Delete removes a secret from the keyring.
+func (k *KeyringStore) Delete(name string) error {
+	args := []string{"clear", "service", k.Service, "name", name}
+	if runtime.GOOS == "darwin" {
+		args = []string{"delete-generic-password", "-s", k.Service, "-a", name}
+	}
+
+	err := exec.Command(k.command(), args...).Run() //nolint: gosec
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+	return err
+}
+
+// FileSecretStore stores secrets in a file encrypted with AES-GCM
+// using a key derived from a passphrase with scrypt.  Passphrase is
+// only called when the file is first read or written.
+type FileSecretStore struct {
+	Path       string
+	Passphrase func() (string, error)
+
+	key, salt []byte
+	secrets   map[string]string
+}
+
+type secretFile struct {
+	Salt, Nonce, Data []byte
+}
+
+// Get returns the secret stored in the file.
+func (f *FileSecretStore) Get(name string) (string, bool, error) {
+	if err := f.load(); err != nil {
+		return "", false, err
+	}
+	value, ok := f.secrets[name]
+	return value, ok, nil
+}
+
+// Set stores a secret in the file.
+func (f *FileSecretStore) Set(name, value string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	f.secrets[name] = value
+	return f.save()
+}
+
+// Delete removes a secret from the file.
+func (f *FileSecretStore) Delete(name string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	delete(f.secrets, name)
+	return f.save()
+}
+
+func (f *FileSecretStore) load() error {
+	if f.secrets != nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		f.salt = make([]byte, 16)
+		if _, err := rand.Read(f.salt); err != nil {
+			return err
+		}
+		f.secrets = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file secretFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	f.salt = file.Salt
+	aead, err := f.aead()
+	if err != nil {
+		return err
+	}
+	plain, err := aead.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return errors.New("cannot decrypt " + f.Path + ": wrong passphrase?")
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return err
+	}
+	f.secrets = secrets
+	return nil
+}
+
+func (f *FileSecretStore) save() error {
+	plain, err := json.Marshal(f.secrets)
+	if err != nil {
+		return err
+	}
+	aead, err := f.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(secretFile{f.salt, nonce, aead.Seal(nil, nonce, plain, nil)})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, data, 0600)
+}
+
+func (f *FileSecretStore) aead() (cipher.AEAD, error) {
+	if f.key == nil {
+		passphrase, err := f.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, errors.New("empty passphrase")
+		}
+		f.key, err = scrypt.Key([]byte(passphrase), f.salt, 1<<15, 8, 1, 32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(f.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
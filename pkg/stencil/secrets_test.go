@@ -0,0 +1,168 @@
+package stencil_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestSecretVars(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineSecret "token" "API token" "validate=nonempty" }}
+{{ stencil.VarSecret "token" }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}`,
+		"tpl": `token={{ stencil.VarSecret "token" }}`,
+	}
+	secrets := mapSecrets{}
+
+	discard := discardLogger{}
+	main := func(p stencil.Prompter, args ...string) (string, error) {
+		var out bytes.Buffer
+		s := stencil.New(discard, discard, p, fs)
+		s.Stdout, s.Secrets = &out, secrets
+		args = append([]string{"stencil"}, args...)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+		return out.String(), err
+	}
+
+	p := &secretPrompter{fakePrompter{"public"}, "s3cret", 0}
+	if _, err := main(p, "pull", "recipe.md"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if fs["out.txt"] != "token=s3cret" || secrets["token"] != "s3cret" || p.secrets != 1 {
+		t.Error("Unexpected", fs["out.txt"], secrets, p.secrets)
+	}
+	for _, name := range []string{".stencil/manifest.json", ".stencil/objects.json"} {
+		if strings.Contains(fs[name], "s3cret") {
+			t.Error("Secret saved in", name, fs[name])
+		}
+	}
+
+	p.secret = "other"
+	if _, err := main(p, "sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if fs["out.txt"] != "token=s3cret" || p.secrets != 1 {
+		t.Error("Unexpected", fs["out.txt"], p.secrets)
+	}
+
+	if out, err := main(p, "vars"); err != nil || !strings.Contains(out, "(secret)") || strings.Contains(out, "s3cret") {
+		t.Error("Unexpected", out, err)
+	}
+	if _, err := main(p, "vars", "unset", "token"); err != nil || len(secrets) != 0 {
+		t.Error("Unexpected", secrets, err)
+	}
+
+	os.Setenv("STENCIL_VAR_TOKEN", "env")
+	defer os.Unsetenv("STENCIL_VAR_TOKEN")
+	for _, args := range [][]string{{"sync", "--dry-run"}, {"diff"}, {"check"}} {
+		main(p, args...) //nolint: errcheck
+		if len(secrets) != 0 {
+			t.Error("Secret saved by", args, secrets)
+		}
+	}
+}
+
+func TestFileSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets", "x.json")
+	passphrase := func(s string) func() (string, error) {
+		return func() (string, error) { return s, nil }
+	}
+
+	store := &stencil.FileSecretStore{Path: path, Passphrase: passphrase("pass")}
+	if err := store.Set("token", "s3cret"); err != nil {
+		t.Fatal("Set", err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || bytes.Contains(data, []byte("s3cret")) {
+		t.Error("Unexpected", string(data), err)
+	}
+
+	store = &stencil.FileSecretStore{Path: path, Passphrase: passphrase("pass")}
+	if val, ok, err := store.Get("token"); err != nil || !ok || val != "s3cret" {
+		t.Error("Unexpected", val, ok, err)
+	}
+	if err := store.Delete("token"); err != nil {
+		t.Error("Delete", err)
+	}
+	if _, ok, err := store.Get("token"); err != nil || ok {
+		t.Error("Unexpected", ok, err)
+	}
+
+	store = &stencil.FileSecretStore{Path: path, Passphrase: passphrase("wrong")}
+	if _, _, err := store.Get("token"); err == nil {
+		t.Error("Unexpected success with the wrong passphrase")
+	}
+}
+
+type mapSecrets map[string]string
+
+func (m mapSecrets) Get(name string) (string, bool, error) {
+	v, ok := m[name]
+	return v, ok, nil
+}
+
+func (m mapSecrets) Set(name, value string) error {
+	m[name] = value
+	return nil
+}
+
+func (m mapSecrets) Delete(name string) error {
+	delete(m, name)
+	return nil
+}
+
+type secretPrompter struct {
+	fakePrompter
+	secret  string
+	secrets int
+}
+
+func (s *secretPrompter) PromptSecret(prompt string) (string, error) {
+	s.secrets++
+	return s.secret, nil
+}
+
+func TestKeyringAvailable(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("fake secret-tool needs a shell")
+	}
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir)
+
+	k := &stencil.KeyringStore{Service: "stencil:test"}
+	scripts := map[string]bool{
+		"":                         false,
+		"exit 1":                   true,
+		"echo no dbus >&2; exit 1": false,
+	}
+	for script, expected := range scripts {
+		os.Remove(filepath.Join(dir, "secret-tool"))
+		if script != "" {
+			err := ioutil.WriteFile(filepath.Join(dir, "secret-tool"), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+			if err != nil {
+				t.Fatal("WriteFile", err)
+			}
+		}
+		if k.Available() != expected {
+			t.Errorf("%q: unexpected Available %v", script, !expected)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package stencil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// The possible states of a managed file as reported by Status.
+const (
+	StatusClean    = "clean"
+	StatusModified = "modified"
+	StatusMissing  = "missing"
+	StatusOrphaned = "orphaned"
+	StatusUnknown  = "unknown"
+)
+
+// FileStatus is the state of a single managed file.
+type FileStatus struct {
+	Pull, Key, Path, Status string
+}
+
+// ErrDrift is returned by Status when any managed file is not clean.
+var ErrDrift = errors.New("managed files have drifted")
+
+// FileStatuses compares all the files recorded in objects.json with
+// the local files.  Files owned by pulls which are no longer active
+// are reported as orphaned.  Files recorded by older versions of
+// stencil without a digest are reported as unknown.
+//
+// The result is sorted by pull, key and path.
+func (s *Stencil) FileStatuses() ([]FileStatus, error) {
+	return s.fileStatuses(&s.Objects)
+}
+
+func (s *Stencil) fileStatuses(o *Objects) ([]FileStatus, error) {
+	result := []FileStatus{}
+	add := func(pull, key, path, digest string) error {
+		_, active := o.Pulls[pull]
+		status, err := s.fileStatus(pull == "" || active, path, digest)
+		result = append(result, FileStatus{pull, key, path, status})
+		return err
+	}
+
+	for key, f := range o.Files {
+		if err := add(f.Pull, key, filepath.Clean(f.Loc), f.Digest); err != nil {
+			return nil, err
+		}
+	}
+	for key, f := range o.FileArchives {
+		if len(f.Digests) == 0 {
+			if err := add(f.Pull, key, filepath.Clean(f.Loc), ""); err != nil {
+				return nil, err
+			}
+		}
+		for path, digest := range f.Digests {
+			if err := add(f.Pull, key, path, digest); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Pull != b.Pull {
+			return a.Pull < b.Pull
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Path < b.Path
+	})
+	return result, nil
+}
+
+func (s *Stencil) fileStatus(active bool, path, digest string) (string, error) {
+	if !active {
+		return StatusOrphaned, nil
+	}
+
+	data, err := s.Read(path)
+	switch {
+	case os.IsNotExist(err):
+		return StatusMissing, nil
+	case err != nil:
+		return "", err
+	case digest == "":
+		return StatusUnknown, nil
+	case Digest(data) != digest:
+		return StatusModified, nil
+	}
+	return StatusClean, nil
+}
+
+// Status reports the state of all managed files grouped by pull and
+// key.  It returns ErrDrift if any of the files is not clean.
+func (s *Stencil) Status() error {
+	if err := s.Objects.LoadObjects(); err != nil {
+		return s.Errorf("LoadObjects %v\n", err)
+	}
+	s.Objects.restore()
+
+	statuses, err := s.FileStatuses()
+	if err != nil {
+		return s.Errorf("status %v\n", err)
+	}
+
+	drift := false
+	for kk, st := range statuses {
+		newPull := kk == 0 || st.Pull != statuses[kk-1].Pull
+		if newPull && st.Pull == "" {
+			s.Printf("(unknown pull)\n")
+		} else if newPull {
+			s.Printf("%s\n", st.Pull)
+		}
+		if newPull || st.Key != statuses[kk-1].Key {
+			s.Printf("  %s\n", st.Key)
+		}
+		s.Printf("    %-8s %s\n", st.Status, st.Path)
+		drift = drift || st.Status != StatusClean
+	}
+
+	if drift {
+		return s.Errorf("status %v\n", ErrDrift)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package stencil_test
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestStatus(t *testing.T) {
+	fs := memFS{
+		"recipe": `{{ stencil.CopyFile "a" "a.txt" "source" }}
+{{ stencil.CopyFile "b" "b.txt" "source" }}
+{{ stencil.CopyFile "c" "c.txt" "source" }}`,
+		"source": "hello\n",
+	}
+	discard := discardLogger{}
+	main := func(args ...string) (*stencil.Stencil, error) {
+		s := stencil.New(discard, discard, nil, fs)
+		args = append([]string{"stencil"}, args...)
+		return s, s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	if _, err := main("pull", "recipe"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if _, err := main("status"); err != nil {
+		t.Fatal("status", err)
+	}
+
+	fs["a.txt"] = "edited\n"
+	delete(fs, "b.txt")
+	s, err := main("status")
+	if !errors.Is(err, stencil.ErrDrift) {
+		t.Fatal("Unexpected status", err)
+	}
+
+	statuses, err := s.FileStatuses()
+	if err != nil {
+		t.Fatal("FileStatuses", err)
+	}
+	expected := []stencil.FileStatus{
+		{Pull: "recipe", Key: "a", Path: "a.txt", Status: stencil.StatusModified},
+		{Pull: "recipe", Key: "b", Path: "b.txt", Status: stencil.StatusMissing},
+		{Pull: "recipe", Key: "c", Path: "c.txt", Status: stencil.StatusClean},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatal("Unexpected statuses", statuses)
+	}
+	for kk := range expected {
+		if statuses[kk] != expected[kk] {
+			t.Error("Unexpected status", statuses[kk], expected[kk])
+		}
+	}
+
+	// local edits kept by a sync are still reported.
+	if _, err := main("sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if fs["a.txt"] != "edited\n" {
+		t.Error("Unexpected merge", fs["a.txt"])
+	}
+	if s, err = main("status"); !errors.Is(err, stencil.ErrDrift) {
+		t.Error("Unexpected status after sync", err)
+	}
+	if statuses, err := s.FileStatuses(); err != nil || statuses[0].Status != stencil.StatusModified {
+		t.Error("Unexpected statuses after sync", statuses, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"errors"
 	"flag"
+	"io"
 	"os"
 	"text/template"
 )
@@ -37,6 +38,7 @@ func New(verbose, errorl Logger, p Prompter, fs FileSystem) *Stencil {
 	s := &Stencil{
 		State:  map[string]interface{}{},
 		Funcs:  map[string]interface{}{},
+		Stdout: os.Stdout,
 		Printf: verbose.Printf,
 		Errorf: func(fmt string, v ...interface{}) error {
 			errorl.Printf(fmt, v...)
@@ -46,36 +48,64 @@ func New(verbose, errorl Logger, p Prompter, fs FileSystem) *Stencil {
 		FileSystem: fs,
 		Prompter:   p,
 		Binary:     Binary{},
-		Objects: Objects{
-			Before:       &Objects{},
-			Pulls:        map[string]bool{},
-			Files:        map[string]*FileObj{},
-			FileArchives: map[string]*FileArchiveObj{},
-			Bools:        map[string]bool{},
-			Strings:      map[string]string{},
-		},
-		Vars: Vars{
-			BoolDefs:   map[string]string{},
-			StringDefs: map[string]string{},
-		},
-		Markdown: Markdown{},
+		Vars:       Vars{secrets: map[string]string{}, answered: map[string]string{}},
+		Markdown:   Markdown{},
+		Locks:      Locks{update: map[string]bool{}},
 	}
 	s.Binary.Stencil = s
-	s.Objects.Stencil = s
 	s.Vars.Stencil = s
 	s.Markdown.Stencil = s
+	s.reset()
 	s.Funcs["stencil"] = func() interface{} {
 		return s
 	}
 	return s
 }
 
+// reset clears the objects, pins and unanswered variables of a
+// previous run.  The pulls being updated are kept.
+func (s *Stencil) reset() {
+	s.Objects = Objects{
+		Stencil:      s,
+		Before:       &Objects{},
+		Pulls:        map[string]bool{},
+		Deps:         map[string][]string{},
+		Instances:    map[string]string{},
+		Files:        map[string]*FileObj{},
+		FileArchives: map[string]*FileArchiveObj{},
+		Bools:        map[string]bool{},
+		Strings:      map[string]string{},
+		Ints:         map[string]int{},
+		Lists:        map[string][]string{},
+		Maps:         map[string]map[string]string{},
+		Definitions:  map[string]*VarDef{},
+		Sources:      map[string]string{},
+		Previous:     map[string]string{},
+		Conflicts:    map[string]bool{},
+	}
+	s.Locks = Locks{
+		Stencil: s,
+		Pins:    map[string]map[string]string{},
+		locked:  map[string]map[string]string{},
+		update:  s.Locks.update,
+	}
+	s.Vars.unanswered = nil
+}
+
 // Stencil maintains all the state for managing a single directory.
+//
+// Stdout is where the output of commands meant for consumption by
+// other programs (such as the --json output) is written.  Secrets is
+// where the values of secret variables are stored and Globals (if not
+// nil) holds the values shared by all workspaces.
 type Stencil struct {
-	State  map[string]interface{}
-	Funcs  map[string]interface{}
-	Printf func(format string, v ...interface{})
-	Errorf func(format string, v ...interface{}) error
+	State   map[string]interface{}
+	Funcs   map[string]interface{}
+	Stdout  io.Writer
+	Secrets SecretStore
+	Globals *GlobalVars
+	Printf  func(format string, v ...interface{})
+	Errorf  func(format string, v ...interface{}) error
 	FileSystem
 	Prompter
 	Env
@@ -83,6 +113,14 @@ type Stencil struct {
 	Objects
 	Vars
 	Markdown
+	Locks
+
+	dryRun, json bool
+	noInput      bool
+	global       bool
+	as           string
+	sources      []string
+	templates    []*template.Template
 }
 
 // Main implements the main program.
@@ -91,75 +129,208 @@ func (s *Stencil) Main(f *flag.FlagSet, args []string) error {
 	f.Usage = func() {
 		s.Printf(`Usage: stencil [options] commands
   commands:
-    pull url_or_file -- add url to pulls and sync
-    rm url_or_fil    -- remove url from pulls and sync
-    sync             -- update all existing pulls
+    pull url_or_file   -- add url to pulls and sync
+    pull url --as name -- add a named instance of url and sync
+    rm url_or_file     -- remove url from pulls and sync
+    rm name            -- remove a named instance and sync
+    sync               -- update all existing pulls
+    update [url]       -- move the pinned commits of a pull (or all) forward
+    diff               -- show the changes sync would make
+    check              -- fail if sync would change anything, without prompting
+    status             -- report managed files that were modified locally
+    resolve            -- list files with merge conflicts
+    resolve file       -- mark a hand-edited file as resolved
+    resolve file how   -- resolve conflicts using ours, theirs or union
+    vars [list]        -- list all variables with their values
+    vars get name      -- print the value of a variable
+    vars set name=val  -- change the value of a variable
+    vars unset name    -- forget a value so it is prompted for again
+    vars ... --global  -- use the values shared by all workspaces
 `)
 		f.PrintDefaults()
 	}
+	f.BoolVar(&s.dryRun, "dry-run", false, "print the changes pull, rm or sync would make without making them")
+	f.BoolVar(&s.json, "json", false, "print output as json")
+	f.StringVar(&s.as, "as", "", "name of the instance to pull, to pull a recipe more than once")
+	f.BoolVar(&s.noInput, "no-input", false, "fail listing all variables without a value instead of prompting")
+	f.BoolVar(&s.global, "global", false, "with vars, use the values shared by all workspaces")
 	s.Vars.Init(f)
-	if err := f.Parse(args[1:]); err != nil {
+	positional, err := parseArgs(f, args[1:])
+	if err != nil {
 		return s.Errorf("flagset parse", err)
 	}
+	if err := s.Vars.LoadAnswers(); err != nil {
+		return s.Errorf("answers %v\n", err)
+	}
+	arg := func(n int) string {
+		if n < len(positional) {
+			return positional[n]
+		}
+		return ""
+	}
 
-	switch f.Arg(0) {
+	switch arg(0) {
 	case "pull":
-		if f.Arg(1) != "" {
-			s.Printf("Adding %s\n", f.Arg(1))
-			return s.run(f.Arg(1), "")
+		if arg(1) != "" && s.as != "" {
+			s.Printf("Adding %s as %s\n", arg(1), s.as)
+			s.Objects.addInstance(s.as, arg(1))
+			s.Vars.scopeDefs(s.as)
+			return s.run(s.as, "")
+		}
+		if arg(1) != "" {
+			s.Printf("Adding %s\n", arg(1))
+			return s.run(arg(1), "")
 		}
 		return s.Errorf("pull requires a url or path to a recipe %v\n", errMissingArg)
 	case "sync":
 		s.Printf("Updating all pulled recipes\n")
 		return s.run("", "")
 	case "rm":
-		if f.Arg(1) != "" {
-			s.Printf("Removing %s\n", f.Arg(1))
-			return s.run("", f.Arg(1))
+		if arg(1) != "" {
+			s.Printf("Removing %s\n", arg(1))
+			return s.run("", arg(1))
 		}
 		return s.Errorf("rm requires a url or path to a recipe %v\n", errMissingArg)
+	case "update":
+		if arg(1) == "" {
+			s.Printf("Updating all pinned commits\n")
+		} else {
+			s.Printf("Updating pinned commits of %s\n", arg(1))
+		}
+		s.UpdateLocks(arg(1))
+		return s.run("", "")
+	case "diff":
+		return s.Diff()
+	case "check":
+		return s.Check()
+	case "status":
+		return s.Status()
+	case "resolve":
+		return s.Resolve(arg(1), arg(2))
+	case "vars":
+		return s.Variables(arg(1), arg(2))
 	case "":
 		f.Usage()
 		return nil
 	}
-	return s.Errorf("%v", errors.New("unknown command: "+f.Arg(0)))
+	return s.Errorf("%v", errors.New("unknown command: "+arg(0)))
+}
+
+// parseArgs parses the flags, allowing them to be mixed with the
+// positional args which are returned.
+func parseArgs(f *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := f.Parse(args); err != nil {
+			return nil, err
+		}
+		if f.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, f.Arg(0))
+		args = f.Args()[1:]
+	}
 }
 
 func (s *Stencil) run(add, rm string) error {
+	if err := s.discover(add, rm); err != nil {
+		return err
+	}
+	if !s.dryRun {
+		return s.apply(add, rm)
+	}
+
+	plan := NewPlan(s.FileSystem)
+	s.FileSystem = plan
+	defer func() { s.FileSystem = plan.FileSystem }()
+	if err := s.apply(add, rm); err != nil {
+		return err
+	}
+	return s.printPlan(plan)
+}
+
+// apply loads the objects and pins, runs all the pulls, garbage
+// collects and saves the objects.
+func (s *Stencil) apply(add, rm string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	return s.applyLoaded(add, rm)
+}
+
+// load loads the objects and pins saved by the previous run.
+func (s *Stencil) load() error {
 	if err := s.Objects.LoadObjects(); err != nil {
 		return s.Errorf("LoadObjects %v\n", err)
 	}
-	for pull := range s.Before.Pulls {
-		if pull != rm {
-			s.Objects.addPull(pull)
+	if err := s.LoadLocks(); err != nil {
+		return s.Errorf("LoadLocks %v\n", err)
+	}
+	return nil
+}
+
+// applyLoaded is like apply once the objects and pins are loaded.
+func (s *Stencil) applyLoaded(add, rm string) error {
+	for pull, explicit := range s.Before.Pulls {
+		if !explicit || pull == rm {
+			continue
+		}
+		if url, ok := s.Before.Instances[pull]; ok && s.Instances[pull] == "" {
+			s.Objects.addInstance(pull, url)
 		}
+		s.Objects.addPull(pull, true)
 	}
 	if add != "" {
-		s.Objects.addPull(add)
+		s.Objects.addPull(add, true)
 	}
-	for pull := range s.Pulls {
-		s.Printf("Pulling %s\n", pull)
-		if err := s.Run(pull); err != nil {
-			return s.Errorf("Run: %v\n", err)
-		}
+	if err := s.runPulls(); err != nil {
+		return s.Errorf("Run: %v\n", err)
 	}
 	if err := s.GC(); err != nil {
 		return s.Errorf("GC %v\n", err)
 	}
 
-	return s.SaveObjects()
+	if err := s.SaveObjects(); err != nil {
+		return err
+	}
+	return s.SaveLocks()
 }
 
-// CopyFile copies a url to a local file.
+func (s *Stencil) printPlan(plan *Plan) error {
+	if !s.json {
+		plan.Print(s.Stdout)
+		return nil
+	}
+
+	data, err := plan.JSON()
+	if err != nil {
+		return s.Errorf("json %v\n", err)
+	}
+	_, err = s.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// CopyFile copies a url to a local file.  Any changes made to the
+// local file since the last copy are preserved via a three-way merge.
+//
+// Relative urls are resolved against the url of the template calling
+// CopyFile (see ResolveURL).
 func (s *Stencil) CopyFile(key, localPath, url string) error {
+	resolved, err := s.resolve(url)
+	if err != nil {
+		return s.Errorf("Error resolving %s %v\n", url, err)
+	}
+	url = resolved
+
 	s.Printf("copying %s to %s, key (%s)\n", url, localPath, key)
-	s.Objects.addFile(key, localPath, url)
+	f := s.Objects.addFile(key, localPath, url, s.Objects.strategy(key))
 
 	data, err := s.Execute(url)
 	if err != nil {
 		return s.Errorf("Error reading %s %v\n", url, err)
 	}
-	return s.Write(localPath, []byte(data), 0666)
+	_, err = s.writeMerged(f, []byte(data))
+	return err
 }
 
 // Run runs a template discarding the output.
@@ -168,8 +339,15 @@ func (s *Stencil) Run(source string) error {
 	return err
 }
 
-// Import imports a template after applying it.
+// Import imports a template after applying it.  Relative sources
+// are resolved against the url of the calling template.
 func (s *Stencil) Import(source string) (string, error) {
+	resolved, err := s.resolve(source)
+	if err != nil {
+		return "", s.Errorf("Error resolving %s: %v\n", source, err)
+	}
+	source = resolved
+
 	s.Printf("Running import %s\n", source)
 	return s.Execute(source)
 }
@@ -179,12 +357,46 @@ func (s *Stencil) Execute(source string) (string, error) {
 	return s.executeFilter(source, nil)
 }
 
+// Include executes another template as part of the calling template
+// and returns its output.  Unlike Import, the included template
+// shares the named templates of the caller, so blocks defined via
+// {{ define }} in one can be used in the other via {{ template }}.
+// Relative sources are resolved against the url of the caller.
+func (s *Stencil) Include(source string) (string, error) {
+	if len(s.templates) == 0 {
+		return s.Import(source)
+	}
+
+	resolved, err := s.resolve(source)
+	if err != nil {
+		return "", s.Errorf("Error resolving %s: %v\n", source, err)
+	}
+	source = resolved
+
+	s.Printf("Including %s\n", source)
+	for _, included := range s.sources {
+		if included == source {
+			return "", s.Errorf("Error including %s: %v\n", source, errors.New(source+" includes itself"))
+		}
+	}
+
+	data, err := s.readSource(source)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := s.templates[len(s.templates)-1].New(source).Parse(string(data))
+	if err != nil {
+		return "", s.Errorf("Error parsing %s: %v\n", source, err)
+	}
+	return s.executeTemplate(source, t)
+}
+
 func (s *Stencil) executeFilter(source string, filter func(string) (string, error)) (string, error) {
 	s.Printf("Executing %s\n", source)
-
-	data, err := s.Read(source)
+	data, err := s.readSource(source)
 	if err != nil {
-		return "", s.Errorf("Error reading %s: %v\n", source, err)
+		return "", err
 	}
 
 	if filter != nil {
@@ -199,12 +411,36 @@ func (s *Stencil) executeFilter(source string, filter func(string) (string, erro
 	if err != nil {
 		return "", s.Errorf("Error parsing %s: %v\n", source, err)
 	}
+	return s.executeTemplate(source, t)
+}
 
-	var buf bytes.Buffer
-	err = t.Execute(&buf, s.State)
+// readSource reads a template at the commit pinned for it.
+func (s *Stencil) readSource(source string) ([]byte, error) {
+	url, err := s.pinned(source)
 	if err != nil {
-		return "", s.Errorf("Error executing %s: %v\n", source, err)
+		return nil, s.Errorf("Error resolving %s: %v\n", source, err)
 	}
 
+	data, err := s.Read(url)
+	if err != nil {
+		return nil, s.Errorf("Error reading %s: %v\n", source, err)
+	}
+	return data, nil
+}
+
+// executeTemplate executes a parsed template, tracking its source so
+// that relative urls and includes within it can be resolved.
+func (s *Stencil) executeTemplate(source string, t *template.Template) (string, error) {
+	s.sources = append(s.sources, source)
+	s.templates = append(s.templates, t)
+	defer func() {
+		s.sources = s.sources[:len(s.sources)-1]
+		s.templates = s.templates[:len(s.templates)-1]
+	}()
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, s.State); err != nil {
+		return "", s.Errorf("Error executing %s: %v\n", source, err)
+	}
 	return buf.String(), nil
 }
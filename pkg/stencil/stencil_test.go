@@ -3,6 +3,7 @@ package stencil_test
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -69,3 +70,35 @@ type discardLogger struct{}
 func (discardLogger) Printf(fmt string, v ...interface{}) {
 	log.Printf(fmt, v...)
 }
+
+type memFS map[string]string
+
+func (m memFS) Write(fname string, data []byte, mode os.FileMode) error {
+	m[filepath.Clean(fname)] = string(data)
+	return nil
+}
+
+func (m memFS) Read(fname string) ([]byte, error) {
+	if v, ok := m[filepath.Clean(fname)]; ok {
+		return []byte(v), nil
+	}
+	return nil, &os.PathError{Op: "open", Path: fname, Err: os.ErrNotExist}
+}
+
+func (m memFS) Remove(fname string) error {
+	if _, ok := m[filepath.Clean(fname)]; !ok {
+		return &os.PathError{Op: "remove", Path: fname, Err: os.ErrNotExist}
+	}
+	delete(m, filepath.Clean(fname))
+	return nil
+}
+
+func (m memFS) RemoveAll(dir string) error {
+	dir = filepath.Clean(dir)
+	for fname := range m {
+		if fname == dir || strings.HasPrefix(fname, dir+"/") {
+			delete(m, fname)
+		}
+	}
+	return nil
+}
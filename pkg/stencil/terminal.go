@@ -0,0 +1,324 @@
+package stencil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Keys other than plain runes returned by readKey.
+const (
+	keyUnknown rune = -1 - iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// TerminalPrompt is a Prompter for interactive terminals.  Choices
+// (and booleans) are picked from a list with the arrow keys, answers
+// start out with the previous answer or the default and can be edited
+// in place, invalid answers are reported below the prompt and AskAll
+// shows a summary to confirm before anything is done.
+//
+// Use NewPrompt to fall back to ConsolePrompt when stdin is not a
+// terminal.
+type TerminalPrompt struct {
+	In  *os.File
+	Out io.Writer
+
+	keys *bufio.Reader
+}
+
+// NewPrompt returns a TerminalPrompt if stdin is a terminal and a
+// ConsolePrompt otherwise.
+func NewPrompt(stdin *os.File, stdout io.Writer) Prompter {
+	if terminal.IsTerminal(int(stdin.Fd())) {
+		return &TerminalPrompt{In: stdin, Out: stdout}
+	}
+	return &ConsolePrompt{Stdin: stdin, Stdout: stdout}
+}
+
+// PromptBool prompts for a bool.
+func (t *TerminalPrompt) PromptBool(prompt string) (bool, error) {
+	answer, err := t.Ask(&Question{VarDef: &VarDef{Type: TypeBool, Prompt: prompt}})
+	if err != nil {
+		return false, err
+	}
+	return parseBool(answer)
+}
+
+// PromptString prompts for a string.
+func (t *TerminalPrompt) PromptString(prompt string) (string, error) {
+	return t.raw(func() (string, error) {
+		return t.editLine(prompt+"? ", "", false, nil)
+	})
+}
+
+// PromptSecret prompts for a string, showing a * for every character.
+func (t *TerminalPrompt) PromptSecret(prompt string) (string, error) {
+	return t.raw(func() (string, error) {
+		return t.editLine(prompt+"? ", "", true, nil)
+	})
+}
+
+// Ask prompts for a variable until the answer is valid.
+func (t *TerminalPrompt) Ask(q *Question) (string, error) {
+	return t.raw(func() (string, error) {
+		if q.Help != "" {
+			fmt.Fprintf(t.Out, "%s\r\n", q.Help)
+		}
+		initial := q.Previous
+		if initial == "" {
+			initial = q.Default
+		}
+
+		switch {
+		case q.Type == TypeBool:
+			selected := 1
+			if b, err := parseBool(initial); err == nil && b {
+				selected = 0
+			}
+			return t.selectChoice(q.Prompt, []string{"yes", "no"}, selected)
+		case len(q.Choices) > 0:
+			selected := 0
+			for kk, choice := range q.Choices {
+				if choice == initial {
+					selected = kk
+				}
+			}
+			return t.selectChoice(q.Prompt, q.Choices, selected)
+		}
+
+		label := q.Prompt
+		if hint := q.Hint(); hint != "" {
+			label += " " + hint
+		}
+		return t.editLine(label+"? ", initial, q.Type == TypeSecret, q.Check)
+	})
+}
+
+// AskAll asks all the questions and then shows a summary of the
+// answers.  If the answers are not confirmed, all the questions are
+// asked again starting out with the answers given.
+func (t *TerminalPrompt) AskAll(questions []*Question) ([]string, error) {
+	pending := make([]*Question, len(questions))
+	for kk, q := range questions {
+		copied := *q
+		pending[kk] = &copied
+	}
+
+	answers := make([]string, len(pending))
+	for {
+		for kk, q := range pending {
+			answer, err := t.Ask(q)
+			if err != nil {
+				return nil, err
+			}
+			answers[kk] = answer
+			q.Previous = answer
+		}
+
+		confirmed, err := t.raw(func() (string, error) {
+			t.printSummary(pending, answers)
+			return t.selectChoice("Continue with these answers", []string{"yes", "no"}, 0)
+		})
+		if err != nil || confirmed == "yes" {
+			return answers, err
+		}
+	}
+}
+
+func (t *TerminalPrompt) printSummary(questions []*Question, answers []string) {
+	width := 0
+	for _, q := range questions {
+		if len(q.Name) > width {
+			width = len(q.Name)
+		}
+	}
+
+	fmt.Fprintf(t.Out, "\r\nSummary:\r\n")
+	for kk, q := range questions {
+		answer := answers[kk]
+		if q.Type == TypeSecret {
+			answer = strings.Repeat("*", len(answer))
+		}
+		fmt.Fprintf(t.Out, "  %-*s  %s\r\n", width, q.Name, answer)
+	}
+}
+
+// raw puts the terminal in raw mode for the duration of f.
+func (t *TerminalPrompt) raw(f func() (string, error)) (string, error) {
+	if t.keys == nil {
+		t.keys = bufio.NewReader(t.In)
+	}
+	fd := int(t.In.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer terminal.Restore(fd, state) //nolint: errcheck
+	return f()
+}
+
+// selectChoice shows the choices as a list with the selected one
+// marked.  The arrow keys move the selection, as do digits and the
+// first letter of a choice, and enter picks it.
+func (t *TerminalPrompt) selectChoice(label string, choices []string, selected int) (string, error) {
+	fmt.Fprintf(t.Out, "%s?\r\n", label)
+	for {
+		for kk, choice := range choices {
+			marker := "  "
+			if kk == selected {
+				marker = "> "
+			}
+			fmt.Fprintf(t.Out, "\r\x1b[K%s%s\r\n", marker, choice)
+		}
+
+		key, err := t.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case key == '\r' || key == '\n':
+			return choices[selected], nil
+		case key == keyUp:
+			selected = (selected + len(choices) - 1) % len(choices)
+		case key == keyDown || key == '\t':
+			selected = (selected + 1) % len(choices)
+		case key >= '1' && key <= '9' && int(key-'1') < len(choices):
+			selected = int(key - '1')
+		default:
+			for kk, choice := range choices {
+				if strings.HasPrefix(strings.ToLower(choice), strings.ToLower(string(key))) {
+					selected = kk
+					break
+				}
+			}
+		}
+		fmt.Fprintf(t.Out, "\x1b[%dA", len(choices))
+	}
+}
+
+// editLine reads a line starting out with text.  The answer is
+// checked with validate (if not nil) when enter is pressed and any
+// error is shown below the line until the answer is fixed.
+func (t *TerminalPrompt) editLine(prompt, text string, mask bool, validate func(string) error) (string, error) {
+	line := []rune(text)
+	pos := len(line)
+	for {
+		shown := string(line)
+		if mask {
+			shown = strings.Repeat("*", len(line))
+		}
+		fmt.Fprintf(t.Out, "\r\x1b[K%s%s", prompt, shown)
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(t.Out, "\x1b[%dD", back)
+		}
+
+		key, err := t.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case key == '\r' || key == '\n':
+			if validate != nil {
+				if err := validate(string(line)); err != nil {
+					fmt.Fprintf(t.Out, "\r\n\x1b[K  %v\x1b[1A", err)
+					continue
+				}
+			}
+			fmt.Fprintf(t.Out, "\r\n\x1b[K")
+			return string(line), nil
+		case key == 4 && len(line) == 0:
+			return "", errors.New("no answer: end of input")
+		case key == 0x7f || key == '\b':
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case key == keyDelete:
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case key == keyLeft && pos > 0:
+			pos--
+		case key == keyRight && pos < len(line):
+			pos++
+		case key == keyHome || key == 1:
+			pos = 0
+		case key == keyEnd || key == 5:
+			pos = len(line)
+		case key == 0x15:
+			line, pos = line[pos:], 0
+		case key >= ' ':
+			line = append(line[:pos], append([]rune{key}, line[pos:]...)...)
+			pos++
+		}
+	}
+}
+
+// readKey reads a key, decoding the escape sequences of the arrow,
+// home, end and delete keys.  The escape key is returned as
+// keyUnknown.  Ctrl-C is returned as an error as the
+// terminal does not send signals in raw mode.
+func (t *TerminalPrompt) readKey() (rune, error) {
+	r, _, err := t.keys.ReadRune()
+	switch {
+	case err != nil:
+		return 0, err
+	case r == 3:
+		return 0, errInterrupted
+	case r != 0x1b:
+		return r, nil
+	}
+
+	// The escape sequences of keys arrive in a single read, so an
+	// escape with nothing after it is the escape key itself.  Anything
+	// else after it is left for the next readKey.
+	if t.keys.Buffered() == 0 {
+		return keyUnknown, nil
+	}
+	if next, _ := t.keys.Peek(1); next[0] != '[' && next[0] != 'O' {
+		return keyUnknown, nil
+	}
+	t.keys.ReadByte() //nolint: errcheck
+	params := ""
+	for {
+		if r, _, err = t.keys.ReadRune(); err != nil {
+			return 0, err
+		}
+		if r >= '@' && r <= '~' {
+			break
+		}
+		params += string(r)
+	}
+
+	switch {
+	case r == 'A':
+		return keyUp, nil
+	case r == 'B':
+		return keyDown, nil
+	case r == 'C':
+		return keyRight, nil
+	case r == 'D':
+		return keyLeft, nil
+	case r == 'H' || r == '~' && (params == "1" || params == "7"):
+		return keyHome, nil
+	case r == 'F' || r == '~' && (params == "4" || params == "8"):
+		return keyEnd, nil
+	case r == '~' && params == "3":
+		return keyDelete, nil
+	}
+	return keyUnknown, nil
+}
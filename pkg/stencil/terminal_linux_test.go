@@ -0,0 +1,195 @@
+package stencil_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/argots/stencil/pkg/stencil"
+	"golang.org/x/sys/unix"
+)
+
+func TestTerminalPrompt(t *testing.T) {
+	h := newPTY(t)
+	defer h.Close()
+	p := &stencil.TerminalPrompt{In: h.tty, Out: h.tty}
+
+	ci := &stencil.VarDef{Type: stencil.TypeChoice, Prompt: "CI", Choices: []string{"github", "gitlab", "none"}, Default: "gitlab"}
+	answer := h.run(func() (string, error) { return p.Ask(question("ci", "", ci)) })
+	h.expect("> gitlab")
+	h.send("\x1b[B\r")
+	if got := <-answer; got != "none" {
+		t.Error("Unexpected", got)
+	}
+
+	version := &stencil.VarDef{Type: stencil.TypeString, Prompt: "Go version", Validate: "semver"}
+	answer = h.run(func() (string, error) { return p.Ask(question("go", "1.14", version)) })
+	h.expect("Go version? 1.14")
+	h.send("\x7f\x7fx\r")
+	h.expect("not a semantic version: 1.x")
+	h.send("\x1b[H\x1b[3~2\x1b[F\x7f5\r")
+	if got := <-answer; got != "2.5" {
+		t.Error("Unexpected", got)
+	}
+
+	lint := &stencil.VarDef{Type: stencil.TypeBool, Prompt: "Lint", Default: "no"}
+	name := &stencil.VarDef{Type: stencil.TypeString, Prompt: "Name"}
+	answers := make(chan []string)
+	go func() {
+		result, err := p.AskAll([]*stencil.Question{question("lint", "", lint), question("name", "", name)})
+		if err != nil {
+			t.Error("AskAll", err)
+		}
+		answers <- result
+	}()
+	h.expect("> no")
+	h.send("y\r")
+	h.expect("Name? ")
+	h.send("boo\r")
+	h.expect("Continue with these answers?")
+	h.send("\x1b[A\r")
+	h.expect("> yes")
+	h.send("\r")
+	h.expect("Name? boo")
+	h.send("\x15foo\r")
+	h.expect("  name  foo")
+	h.send("\r")
+	if got := <-answers; strings.Join(got, " ") != "yes foo" {
+		t.Error("Unexpected", got)
+	}
+
+	deploy := &stencil.VarDef{Type: stencil.TypeBool, Prompt: "Deploy"}
+	answer = h.run(func() (string, error) { return p.Ask(question("deploy", "", deploy)) })
+	h.expect("> no")
+	h.send("\x1b")
+	h.expect("> no")
+	h.send("\x1by\r")
+	if got := <-answer; got != "yes" {
+		t.Error("Unexpected", got)
+	}
+
+	answer = h.run(func() (string, error) { return p.PromptString("Name") })
+	h.expect("Name? ")
+	h.send("\x03")
+	if got := <-answer; got != "error: interrupted" {
+		t.Error("Unexpected", got)
+	}
+}
+
+func TestNewPrompt(t *testing.T) {
+	h := newPTY(t)
+	defer h.Close()
+	if _, ok := stencil.NewPrompt(h.tty, h.tty).(*stencil.TerminalPrompt); !ok {
+		t.Error("Unexpected plain prompter for a terminal")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, ok := stencil.NewPrompt(r, w).(*stencil.ConsolePrompt); !ok {
+		t.Error("Unexpected prompter for a pipe")
+	}
+}
+
+func question(name, previous string, def *stencil.VarDef) *stencil.Question {
+	return &stencil.Question{Name: name, Previous: previous, VarDef: def, Check: func(answer string) error {
+		_, err := def.Parse(answer)
+		return err
+	}}
+}
+
+// ptyHarness drives a prompter through a pseudo-terminal: tty is
+// given to the prompter while keys are sent to and the output is
+// read from the other end.
+type ptyHarness struct {
+	t        *testing.T
+	pty, tty *os.File
+
+	mu   sync.Mutex
+	out  bytes.Buffer
+	seen int
+}
+
+func newPTY(t *testing.T) *ptyHarness {
+	t.Helper()
+	pty, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminals", err)
+	}
+	n, err := unix.IoctlGetInt(int(pty.Fd()), unix.TIOCGPTN)
+	if err == nil {
+		err = unix.IoctlSetPointerInt(int(pty.Fd()), unix.TIOCSPTLCK, 0)
+	}
+	if err != nil {
+		pty.Close()
+		t.Fatal("pty", err)
+	}
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		pty.Close()
+		t.Fatal("tty", err)
+	}
+
+	h := &ptyHarness{t: t, pty: pty, tty: tty}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := pty.Read(buf)
+			h.mu.Lock()
+			h.out.Write(buf[:n])
+			h.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return h
+}
+
+// run calls f in the background, returning its answer (or error).
+func (h *ptyHarness) run(f func() (string, error)) chan string {
+	result := make(chan string, 1)
+	go func() {
+		answer, err := f()
+		if err != nil {
+			answer = "error: " + err.Error()
+		}
+		result <- answer
+	}()
+	return result
+}
+
+// expect waits for s to show up in the output since the last expect.
+// Keys must only be sent once the prompt is shown as the terminal is
+// not in raw mode before that.
+func (h *ptyHarness) expect(s string) {
+	h.t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		h.mu.Lock()
+		out := h.out.String()
+		h.mu.Unlock()
+		if idx := strings.Index(out[h.seen:], s); idx >= 0 {
+			h.seen += idx + len(s)
+			return
+		}
+	}
+	h.t.Fatalf("missing %q in %q", s, h.out.String()[h.seen:])
+}
+
+func (h *ptyHarness) send(keys string) {
+	if _, err := h.pty.Write([]byte(keys)); err != nil {
+		h.t.Fatal("send", err)
+	}
+}
+
+func (h *ptyHarness) Close() {
+	h.tty.Close()
+	h.pty.Close()
+}
@@ -0,0 +1,54 @@
+package stencil
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveURL resolves a path relative to the url of a template.
+// Relative paths within git urls are resolved within the same
+// repository and ref, relative paths within http urls are resolved
+// as per RFC 3986 and local paths are resolved relative to the
+// directory of the template.  Absolute paths and urls are returned
+// as is.
+func ResolveURL(base, rel string) (string, error) {
+	if base == "" || isRemote(rel) || filepath.IsAbs(rel) {
+		return rel, nil
+	}
+
+	if _, _, gitPath, ok := (&FS{}).parseGitURL(base); ok {
+		joined := path.Join(path.Dir(strings.TrimPrefix(gitPath, "/")), filepath.ToSlash(rel))
+		if joined == ".." || strings.HasPrefix(joined, "../") {
+			return "", errors.New(rel + " is outside the repository of " + base)
+		}
+		if !strings.HasSuffix(base, gitPath) {
+			return "", errors.New("cannot resolve relative path in " + base)
+		}
+		return strings.TrimSuffix(base, gitPath) + "/" + joined, nil
+	}
+
+	if isHTTP(base) {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(filepath.ToSlash(rel))
+		if err != nil {
+			return "", err
+		}
+		return b.ResolveReference(r).String(), nil
+	}
+
+	return filepath.Join(filepath.Dir(base), rel), nil
+}
+
+// resolve resolves a path relative to the template being executed.
+func (s *Stencil) resolve(rel string) (string, error) {
+	if len(s.sources) == 0 {
+		return rel, nil
+	}
+	return ResolveURL(s.sources[len(s.sources)-1], rel)
+}
@@ -0,0 +1,49 @@
+package stencil_test
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestResolveURL(t *testing.T) {
+	cases := map[string][3]string{
+		"git":        {"git:git@github.com:a/b.git/x/y.md", "z.md", "git:git@github.com:a/b.git/x/z.md"},
+		"git parent": {"git:git@github.com:a/b.git/x/y.md", "../z.md", "git:git@github.com:a/b.git/z.md"},
+		"git ref":    {"git:https://h/a/b.git#v1/x/y.md", "w/z.md", "git:https://h/a/b.git#v1/x/w/z.md"},
+		"git abs":    {"git:git@github.com:a/b.git/x/y.md", "git:git@github.com:c/d.git/z.md", "git:git@github.com:c/d.git/z.md"},
+		"http":       {"https://h/x/y.md", "../z.md", "https://h/z.md"},
+		"local":      {"x/y.md", "../z.md", "z.md"},
+		"no base":    {"", "z.md", "z.md"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := stencil.ResolveURL(c[0], c[1])
+			if err != nil || got != c[2] {
+				t.Error("Unexpected", got, err)
+			}
+		})
+	}
+
+	if _, err := stencil.ResolveURL("git:git@github.com:a/b.git/x/y.md", "../../z.md"); err == nil {
+		t.Error("Unexpected success escaping the repository")
+	}
+}
+
+func TestRelativeCopyFile(t *testing.T) {
+	fs := memFS{
+		"recipes/lib.md":           `{{ stencil.Import "shared/common.md" }}`,
+		"recipes/shared/common.md": `{{ stencil.CopyFile "f" "out.txt" "../files/a.txt" }}`,
+		"recipes/files/a.txt":      "hello",
+	}
+
+	discard := discardLogger{}
+	if err := stencil.New(discard, discard, nil, fs).Main(flag.NewFlagSet("test", flag.ContinueOnError), []string{"stencil", "pull", "recipes/lib.md"}); err != nil {
+		t.Fatal("Pull", err)
+	}
+	if fs["out.txt"] != "hello" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+}
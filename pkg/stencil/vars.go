@@ -1,39 +1,150 @@
 package stencil
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// Variable types.
+const (
+	TypeBool   = "bool"
+	TypeString = "string"
+	TypeChoice = "choice"
+	TypeInt    = "int"
+	TypeList   = "list"
+	TypeMap    = "map"
+	TypeSecret = "secret"
 )
 
-// Vars holds named values.
+// VarDef is the definition of a variable.  Choices is only used by
+// choice variables.  Min and Max are only used by int variables and
+// the range is not checked if both are zero.
+//
+// Default is used in place of empty answers and Help is a longer
+// description shown when prompting.  Validate is either "nonempty" or
+// "semver" and Pattern is a regular expression which the whole value
+// must match.
+//
+// Recipes lists the pulls which define the variable.
+type VarDef struct {
+	Type, Prompt string
+	Choices      []string `json:",omitempty"`
+	Min, Max     int      `json:",omitempty"`
+	Default      string   `json:",omitempty"`
+	Help         string   `json:",omitempty"`
+	Validate     string   `json:",omitempty"`
+	Pattern      string   `json:",omitempty"`
+	Recipes      []string `json:",omitempty"`
+}
+
+// Vars holds named values.  The definitions are recorded in
+// Objects.Definitions.
 type Vars struct {
 	*Stencil
-	defs       defsValue
-	BoolDefs   map[string]string
-	StringDefs map[string]string
+	defs        defsValue
+	answersFile string
+	answers     map[string]string
+	answered    map[string]string
+
+	unanswered []string
+	secrets    map[string]string
 }
 
 // Init initializes vars.  Must be calleed for flag.Parse.
 func (v *Vars) Init(f *flag.FlagSet) {
-	f.Var(&v.defs, "var", "bool_name or bool_name=yes/no/true/false or string_name=value")
+	f.Var(&v.defs, "var", "bool_name or name=value where bools are yes/no/true/false, lists are a,b,c and maps are k1=v1,k2=v2")
+	f.StringVar(&v.answersFile, "answers", "", "json or yaml file with the values of variables")
 }
 
-// DefineBool defines a boolean variable name.
-func (v *Vars) DefineBool(name, prompt string) error {
-	if _, ok := v.BoolDefs[name]; ok {
-		return errors.New("redefiniton of " + name)
+// DefineBool defines a boolean variable name.  See DefineString for
+// the options.
+func (v *Vars) DefineBool(name, prompt string, options ...string) error {
+	def := &VarDef{Type: TypeBool, Prompt: prompt}
+	if err := def.setOptions(options); err != nil {
+		return err
 	}
-	v.BoolDefs[name] = prompt
-	return nil
+	return v.define(name, def)
+}
+
+// DefineString defines a string variable name.  The options are of
+// the form "default=value", "help=text", "validate=nonempty",
+// "validate=semver" or "pattern=regexp".
+func (v *Vars) DefineString(name, prompt string, options ...string) error {
+	def := &VarDef{Type: TypeString, Prompt: prompt}
+	if err := def.setOptions(options); err != nil {
+		return err
+	}
+	return v.define(name, def)
+}
+
+// DefineChoice defines a string variable which must be one of the
+// provided choices.
+func (v *Vars) DefineChoice(name, prompt string, choices ...string) error {
+	if len(choices) == 0 {
+		return errors.New("no choices for " + name)
+	}
+	return v.define(name, &VarDef{Type: TypeChoice, Prompt: prompt, Choices: choices})
+}
+
+// DefineInt defines an integer variable which must be within min and
+// max (inclusive).  Use zero for both for an unbounded integer.
+func (v *Vars) DefineInt(name, prompt string, min, max int) error {
+	if min > max {
+		return errors.New("invalid range for " + name)
+	}
+	return v.define(name, &VarDef{Type: TypeInt, Prompt: prompt, Min: min, Max: max})
+}
+
+// DefineList defines a list of strings variable.
+func (v *Vars) DefineList(name, prompt string) error {
+	return v.define(name, &VarDef{Type: TypeList, Prompt: prompt})
+}
+
+// DefineMap defines a string to string map variable.
+func (v *Vars) DefineMap(name, prompt string) error {
+	return v.define(name, &VarDef{Type: TypeMap, Prompt: prompt})
 }
 
-// DefineString defines a string variable name.
-func (v *Vars) DefineString(name, prompt string) error {
-	if _, ok := v.StringDefs[name]; ok {
-		return errors.New("redefiniton of " + name)
+// DefineSecret defines a secret string variable.  The value is kept
+// in the SecretStore instead of the manifest and is not echoed when
+// prompted for.  The options are the same as with DefineString.
+func (v *Vars) DefineSecret(name, prompt string, options ...string) error {
+	def := &VarDef{Type: TypeSecret, Prompt: prompt}
+	if err := def.setOptions(options); err != nil {
+		return err
 	}
-	v.StringDefs[name] = prompt
+	return v.define(name, def)
+}
+
+// define records the definition of a variable.  Several recipes can
+// define the same variable as long as the types match.
+func (v *Vars) define(name string, def *VarDef) error {
+	name = v.scope(name)
+	if existing, ok := v.Definitions[name]; ok {
+		if existing.Type != def.Type {
+			return errors.New("redefiniton of " + name)
+		}
+		def = existing
+	}
+	for _, r := range def.Recipes {
+		if r == v.Objects.pull {
+			v.Definitions[name] = def
+			return nil
+		}
+	}
+	def.Recipes = append(def.Recipes, v.Objects.pull)
+	v.Definitions[name] = def
 	return nil
 }
 
@@ -42,97 +153,583 @@ func (v *Vars) DefineString(name, prompt string) error {
 // value is prompted for using the prompt in the definition.
 // Any --var use overrides default values present from previous
 // invocations.
+//
+// Variables of recipe instances are named "instance:name".
 func (v *Vars) VarBool(name string) (bool, error) {
-	prompt, ok := v.BoolDefs[name]
-	if !ok {
-		return false, errors.New("undefined variable: " + name)
+	val, err := v.value(name, TypeBool)
+	b, _ := val.(bool)
+	return b, err
+}
+
+// VarString fetches the value for the named variable.  If the value is
+// not present either via --var or via a previous invocation, the
+// value is prompted for using the prompt in the definition.
+// Any --var use overrides default values present from previous
+// invocations.
+//
+// Variables of recipe instances are named "instance:name".
+func (v *Vars) VarString(name string) (string, error) {
+	val, err := v.value(name, TypeString)
+	s, _ := val.(string)
+	return s, err
+}
+
+// VarSecret fetches the value of the named secret variable from
+// --var, the SecretStore or the prompter, in that order.  Values
+// provided via --var or prompted for are saved in the SecretStore.
+func (v *Vars) VarSecret(name string) (string, error) {
+	val, err := v.value(name, TypeSecret)
+	s, _ := val.(string)
+	return s, err
+}
+
+// VarChoice fetches the value for the named choice variable just
+// like VarString.
+func (v *Vars) VarChoice(name string) (string, error) {
+	val, err := v.value(name, TypeChoice)
+	s, _ := val.(string)
+	return s, err
+}
+
+// VarInt fetches the value for the named integer variable just like
+// VarString.
+func (v *Vars) VarInt(name string) (int, error) {
+	val, err := v.value(name, TypeInt)
+	n, _ := val.(int)
+	return n, err
+}
+
+// VarList fetches the value for the named list variable just like
+// VarString.
+func (v *Vars) VarList(name string) ([]string, error) {
+	val, err := v.value(name, TypeList)
+	l, _ := val.([]string)
+	return l, err
+}
+
+// VarMap fetches the value for the named map variable just like
+// VarString.
+func (v *Vars) VarMap(name string) (map[string]string, error) {
+	val, err := v.value(name, TypeMap)
+	m, _ := val.(map[string]string)
+	return m, err
+}
+
+// value fetches the value of a variable from --var, $STENCIL_VAR_NAME,
+// the --answers file, the current run, the previous run, the global
+// values or the prompter, in that order.
+func (v *Vars) value(name, typ string) (interface{}, error) {
+	name = v.scope(name)
+	def, ok := v.Definitions[name]
+	if !ok || def.Type != typ {
+		return nil, errors.New("undefined variable: " + name)
+	}
+	if typ == TypeSecret {
+		return v.secret(name, def)
 	}
 
-	if val, ok := v.defs.bools[name]; ok {
-		v.Bools[name] = val
+	if raw, source, ok := v.provided(name); ok {
+		val, err := def.Parse(raw)
+		if err != nil {
+			return nil, errors.New(source + " " + name + ": " + err.Error())
+		}
+		v.Objects.setVar(name, val, source)
 		return val, nil
 	}
 
-	if val, ok := v.Bools[name]; ok {
+	if val, ok := v.Objects.getVar(name, typ); ok {
 		return val, nil
 	}
 
-	if val, ok := v.Before.Bools[name]; ok {
-		v.Bools[name] = val
+	if val, ok := v.Before.getVar(name, typ); ok {
+		parsed, err := def.Parse(formatVar(val))
+		if err != nil {
+			return nil, errors.New("invalid saved value of " + name + ": " + err.Error() + " (use --var to change it)")
+		}
+		if val == "" {
+			// empty answers saved before the variable had a default
+			val = parsed
+		}
+		v.Objects.setVar(name, val, v.Before.varSource(name))
+		return val, nil
+	}
+
+	if val, ok, err := v.globalValue(name, def); err != nil || ok {
+		if ok {
+			v.Objects.setVar(name, val, SourceGlobal)
+		}
+		return val, err
+	}
+
+	if np, ok := v.Prompter.(noPrompt); ok && np.defaults && def.Default != "" {
+		val, err := def.Parse("")
+		if err != nil {
+			return nil, err
+		}
+		v.Objects.setVar(name, val, SourceDefault)
 		return val, nil
 	}
 
-	val, err := v.PromptBool(prompt)
-	if err == nil {
-		v.Bools[name] = val
+	val, err := v.prompt(name, def)
+	if errors.Is(err, ErrUnanswered) {
+		v.addUnanswered(name)
+		return def.zero(), nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	return val, err
+	v.Objects.setVar(name, val, SourcePrompt)
+	return val, nil
 }
 
-// VarString fetches the value for the named variable.  If the value is
-// not present either via --var or via a previous invocation, the
-// value is prompted for using the prompt in the definition.
-// Any --var use overrides default values present from previous
-// invocations.
-func (v *Vars) VarString(name string) (string, error) {
-	prompt, ok := v.StringDefs[name]
+// secret is like value but for secret variables.  New values are
+// only saved in the SecretStore by runs which write files, not by
+// dry runs, diff, check or discover.
+func (v *Vars) secret(name string, def *VarDef) (interface{}, error) {
+	if val, ok := v.secrets[name]; ok {
+		return val, nil
+	}
+	if v.Secrets == nil {
+		return nil, errors.New("no secret store for " + name)
+	}
+
+	raw, source, ok := v.provided(name)
 	if !ok {
-		return "", errors.New("undefined variable: " + name)
+		val, found, err := v.Secrets.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if _, err := def.Parse(val); err != nil {
+				return nil, errors.New("invalid saved value of " + name + ": " + err.Error() + " (use --var to change it)")
+			}
+			v.secrets[name] = val
+			return val, nil
+		}
 	}
 
-	if val, ok := v.defs.strings[name]; ok {
-		v.Strings[name] = val
+	val, err := def.Parse(raw)
+	if ok && err != nil {
+		return nil, errors.New(source + " " + name + ": " + err.Error())
+	}
+	if !ok {
+		val, err = v.prompt(name, def)
+	}
+	if errors.Is(err, ErrUnanswered) {
+		v.addUnanswered(name)
+		return "", nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.FileSystem.(*Plan); ok {
+		// dry runs, including discover, change nothing
 		return val, nil
 	}
 
-	if val, ok := v.Strings[name]; ok {
-		return val, nil
+	if err := v.Secrets.Set(name, val.(string)); err != nil {
+		return nil, err
 	}
+	v.secrets[name] = val.(string)
+	return val, nil
+}
 
-	if val, ok := v.Before.Strings[name]; ok {
-		v.Strings[name] = val
-		return val, nil
+// globalValue returns the global value of a variable.  The variables
+// of recipe instances also use the global value of the name without
+// the instance prefix.  Global values which are not valid for the
+// variable are ignored with a warning.
+func (v *Vars) globalValue(name string, def *VarDef) (interface{}, bool, error) {
+	if v.Globals == nil {
+		return nil, false, nil
+	}
+
+	names := []string{name}
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		names = append(names, name[idx+1:])
+	}
+	for _, n := range names {
+		raw, ok, err := v.Globals.Get(n)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			continue
+		}
+		val, err := def.Parse(raw)
+		if err == nil {
+			return val, true, nil
+		}
+		v.Errorf("globals %s: ignoring invalid value of %s: %v\n", v.Globals.Path, n, err) //nolint: errcheck
 	}
+	return nil, false, nil
+}
 
-	val, err := v.PromptString(prompt)
+// provided returns the raw value of a variable provided via --var,
+// the environment, the --answers file or answered before the run
+// (see discover) along with where it came from.
+func (v *Vars) provided(name string) (raw, source string, ok bool) {
+	if raw, ok := v.defs.values[name]; ok {
+		return raw, "--var", true
+	}
+	if raw, ok := os.LookupEnv(envVar(name)); ok {
+		return raw, "$" + envVar(name), true
+	}
+	if raw, ok := v.answers[name]; ok {
+		return raw, v.answersFile, true
+	}
+	if raw, ok := v.answered[name]; ok {
+		return raw, SourcePrompt, true
+	}
+	return "", "", false
+}
+
+// envVar returns the environment variable for a variable: the name
+// in upper case with everything but letters and digits replaced by
+// underscores, prefixed with STENCIL_VAR_.  For example, the
+// variable "api:go.version" is read from STENCIL_VAR_API_GO_VERSION.
+func envVar(name string) string {
+	upper := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	return "STENCIL_VAR_" + upper
+}
+
+// LoadAnswers reads the --answers file, if any.  The file is a JSON
+// object (for .json files) or a YAML mapping from variable names to
+// values.  Lists and maps can be written either natively or in the
+// same text form as with --var.  Unlike the files of the workspace,
+// the path is relative to the current directory.
+func (v *Vars) LoadAnswers() error {
+	if v.answersFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(v.answersFile)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	v.Strings[name] = val
-	return val, nil
+	v.answers, err = decodeAnswers(data, strings.HasSuffix(v.answersFile, ".json"))
+	if err != nil {
+		return errors.New(v.answersFile + ": " + err.Error())
+	}
+	return nil
 }
 
-type defsValue struct {
-	bools   map[string]bool
-	strings map[string]string
+// decodeAnswers decodes a JSON or YAML object of values, converting
+// the values to the text form used with --var.
+func decodeAnswers(data []byte, isJSON bool) (map[string]string, error) {
+	values := map[string]interface{}{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	answers := map[string]string{}
+	for name, val := range values {
+		answers[name] = answerString(val)
+	}
+	return answers, nil
 }
 
-func (d *defsValue) String() string {
-	return "serializings defs NYI"
+// answerString converts a decoded JSON or YAML value to the text form
+// used with --var.
+func answerString(val interface{}) string {
+	switch val := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, len(val))
+		for kk, item := range val {
+			items[kk] = answerString(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		m := map[string]string{}
+		for k, item := range val {
+			m[k] = answerString(item)
+		}
+		return formatVar(m)
+	case map[interface{}]interface{}:
+		m := map[string]string{}
+		for k, item := range val {
+			m[fmt.Sprint(k)] = answerString(item)
+		}
+		return formatVar(m)
+	}
+	return fmt.Sprint(val)
 }
 
-func (d *defsValue) Set(value string) error {
-	if d.bools == nil {
-		d.bools = map[string]bool{}
-		d.strings = map[string]string{}
+func (v *Vars) addUnanswered(name string) {
+	for _, n := range v.unanswered {
+		if n == name {
+			return
+		}
+	}
+	v.unanswered = append(v.unanswered, name)
+}
+
+// zero returns the value used for unanswered variables.
+func (d *VarDef) zero() interface{} {
+	switch d.Type {
+	case TypeBool:
+		return false
+	case TypeInt:
+		return 0
+	case TypeList:
+		return []string{}
+	case TypeMap:
+		return map[string]string{}
 	}
+	return ""
+}
 
-	parts := strings.Split(value, "=")
+// prompt asks for the value of a variable.
+func (v *Vars) prompt(name string, def *VarDef) (interface{}, error) {
+	return v.askQuestion(v.question(name, def))
+}
 
-	if len(parts) == 1 {
-		d.bools[value] = true
-		return nil
+// askQuestion asks a question and parses the answer.  Prompters which
+// do not implement QuestionPrompter are asked for a string for all
+// but boolean variables and are not asked again if the answer is
+// invalid.
+func (v *Vars) askQuestion(q *Question) (interface{}, error) {
+	def := q.VarDef
+	var answer string
+	var err error
+	sp, secret := v.Prompter.(SecretPrompter)
+	if qp, ok := v.Prompter.(QuestionPrompter); ok && def.Type != TypeSecret {
+		answer, err = qp.Ask(q)
+	} else if secret && def.Type == TypeSecret {
+		answer, err = sp.PromptSecret(def.Label())
+	} else if def.Type == TypeBool {
+		return v.PromptBool(def.Prompt)
+	} else {
+		answer, err = v.PromptString(def.Label())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return def.Parse(answer)
+}
+
+func (v *Vars) question(name string, def *VarDef) *Question {
+	q := &Question{Name: name, VarDef: def, Check: func(answer string) error {
+		_, err := def.Parse(answer)
+		return err
+	}}
+	q.Previous = v.Before.Previous[name]
+	return q
+}
+
+// setOptions parses the options of DefineString and DefineBool.
+func (d *VarDef) setOptions(options []string) error {
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("invalid option: " + option)
+		}
+		switch parts[0] {
+		case "default":
+			d.Default = parts[1]
+		case "help":
+			d.Help = parts[1]
+		case "validate":
+			if parts[1] != "nonempty" && parts[1] != "semver" {
+				return errors.New("unknown validation: " + parts[1])
+			}
+			d.Validate = parts[1]
+		case "pattern":
+			if _, err := regexp.Compile(parts[1]); err != nil {
+				return err
+			}
+			d.Pattern = parts[1]
+		default:
+			return errors.New("invalid option: " + option)
+		}
+	}
+	if d.Default != "" {
+		if _, err := d.Parse(d.Default); err != nil {
+			return errors.New("invalid default: " + err.Error())
+		}
 	}
+	return nil
+}
 
-	switch strings.ToLower(parts[1]) {
+// Label is the prompt followed by the hint and the default value.
+func (d *VarDef) Label() string {
+	label := d.Prompt
+	if hint := d.Hint(); hint != "" {
+		label += " " + hint
+	}
+	if d.Default != "" {
+		label += " [" + d.Default + "]"
+	}
+	return label
+}
+
+// Hint describes the expected answer, like "(github/gitlab/none)".
+func (d *VarDef) Hint() string {
+	switch d.Type {
+	case TypeBool:
+		return "(Yes/No/True/False)"
+	case TypeChoice:
+		return "(" + strings.Join(d.Choices, "/") + ")"
+	case TypeInt:
+		if d.Min != 0 || d.Max != 0 {
+			return "(" + strconv.Itoa(d.Min) + "-" + strconv.Itoa(d.Max) + ")"
+		}
+		return "(number)"
+	case TypeList:
+		return "(comma separated)"
+	case TypeMap:
+		return "(key=value, comma separated)"
+	}
+	return ""
+}
+
+// Parse converts the text form of a value as used with --var and
+// prompts to the value of the variable.  Empty values are replaced by
+// the default.
+func (d *VarDef) Parse(s string) (interface{}, error) {
+	if strings.TrimSpace(s) == "" && d.Default != "" {
+		s = d.Default
+	}
+
+	switch d.Type {
+	case TypeBool:
+		return parseBool(s)
+	case TypeChoice:
+		for _, choice := range d.Choices {
+			if s == choice {
+				return s, nil
+			}
+		}
+		return nil, errors.New("must be one of " + strings.Join(d.Choices, ", "))
+	case TypeInt:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errors.New("not a number: " + s)
+		}
+		if (d.Min != 0 || d.Max != 0) && (n < d.Min || n > d.Max) {
+			return nil, errors.New("must be between " + strconv.Itoa(d.Min) + " and " + strconv.Itoa(d.Max))
+		}
+		return n, nil
+	case TypeList:
+		return parseList(s), nil
+	case TypeMap:
+		m := map[string]string{}
+		for _, item := range parseList(s) {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.New("not a key=value pair: " + item)
+			}
+			m[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+		return m, nil
+	}
+	return s, d.validate(s)
+}
+
+func (d *VarDef) validate(s string) error {
+	switch {
+	case d.Validate == "nonempty" && strings.TrimSpace(s) == "":
+		return errors.New("must not be empty")
+	case d.Validate == "semver" && !semver.IsValid("v"+strings.TrimPrefix(s, "v")):
+		return errors.New("not a semantic version: " + s)
+	case d.Pattern != "":
+		if ok, _ := regexp.MatchString("^(?:"+d.Pattern+")$", s); !ok {
+			return errors.New("must match " + d.Pattern)
+		}
+	}
+	return nil
+}
+
+func formatVar(val interface{}) string {
+	switch val := val.(type) {
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.Itoa(val)
+	case []string:
+		return strings.Join(val, ",")
+	case map[string]string:
+		pairs := make([]string, 0, len(val))
+		for k, v := range val {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case string:
+		return val
+	}
+	return ""
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "y", "yes", "t", "true":
-		d.bools[parts[0]] = true
-		return nil
+		return true, nil
 	case "n", "no", "f", "false":
-		d.bools[parts[0]] = false
+		return false, nil
+	}
+	return false, errors.New("not a boolean: " + s)
+}
+
+func parseList(s string) []string {
+	result := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// scopeDefs prefixes all the variables provided via --var with the
+// instance name.
+func (v *Vars) scopeDefs(instance string) {
+	values := map[string]string{}
+	for name, val := range v.defs.values {
+		values[instance+":"+name] = val
+	}
+	v.defs.values = values
+}
+
+// defsValue holds the values provided via --var.  Values are only
+// parsed once the type of the variable is known.
+type defsValue struct {
+	values map[string]string
+}
+
+func (d *defsValue) String() string {
+	return "serializings defs NYI"
+}
+
+func (d *defsValue) Set(value string) error {
+	if d.values == nil {
+		d.values = map[string]string{}
+	}
+
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) == 1 {
+		d.values[value] = "true"
 		return nil
 	}
-	d.strings[parts[0]] = parts[1]
+	d.values[parts[0]] = parts[1]
 	return nil
 }
@@ -0,0 +1,267 @@
+package stencil_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestTypedVars(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineChoice "ci" "CI provider" "github" "gitlab" "none" }}
+{{ stencil.DefineInt "replicas" "Replicas" 1 10 }}
+{{ stencil.DefineList "services" "Services" }}
+{{ stencil.DefineMap "labels" "Labels" }}
+{{ stencil.VarChoice "ci" }} {{ stencil.VarInt "replicas" }}
+{{ stencil.VarList "services" }} {{ stencil.VarMap "labels" }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}`,
+		"tpl": `{{ stencil.VarChoice "ci" }} {{ stencil.VarInt "replicas" }}
+{{- range stencil.VarList "services" }} {{ . }}{{ end }}
+{{- range $k, $v := stencil.VarMap "labels" }} {{ $k }}:{{ $v }}{{ end }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(args ...string) error {
+		s := stencil.New(discard, discard, &fakePrompter{"boo"}, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	err := main("pull", "recipe.md", "--var", "ci=gitlab", "--var", "replicas=3",
+		"--var", "services=api, web", "--var", "labels=a=1,b=2")
+	if err != nil {
+		t.Fatal("pull", err)
+	}
+	if err := main("sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if expected := "gitlab 3 api web a:1 b:2"; fs["out.txt"] != expected {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+
+	if err := main("sync", "--var", "replicas=20"); err == nil {
+		t.Error("Unexpected success with out of range --var")
+	}
+	if err := main("sync", "--var", "ci=travis"); err == nil {
+		t.Error("Unexpected success with invalid choice")
+	}
+
+	fs[".stencil/manifest.json"] = `{"Pulls": [{"URL": "recipe.md"}]}`
+	if err := main("sync", "--var", "ci=none", "--var", "services=", "--var", "labels="); err == nil {
+		t.Error("Unexpected success with invalid prompted int")
+	}
+}
+
+func TestConsolePrompt(t *testing.T) {
+	var out bytes.Buffer
+	c := &stencil.ConsolePrompt{Stdin: strings.NewReader("maybe\nyes\nfoo\n7\n2\n"), Stdout: &out}
+
+	if b, err := c.PromptBool("ok"); err != nil || !b {
+		t.Error("Unexpected", b, err)
+	}
+	if s, err := c.PromptString("name"); err != nil || s != "foo" {
+		t.Error("Unexpected", s, err)
+	}
+
+	def := &stencil.VarDef{Type: stencil.TypeChoice, Prompt: "CI", Choices: []string{"github", "gitlab"}}
+	q := &stencil.Question{Name: "ci", VarDef: def, Check: func(answer string) error {
+		_, err := def.Parse(answer)
+		return err
+	}}
+	if s, err := c.Ask(q); err != nil || s != "gitlab" {
+		t.Error("Unexpected", s, err)
+	}
+	if !strings.Contains(out.String(), "  2) gitlab\n") || !strings.Contains(out.String(), "Invalid answer") {
+		t.Error("Unexpected output", out.String())
+	}
+
+	if _, err := c.Ask(q); err == nil {
+		t.Error("Unexpected success at end of input")
+	}
+	if s, err := c.PromptString("name"); err == nil {
+		t.Error("Unexpected blank answer at end of input", s)
+	}
+}
+
+func TestUnattended(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "go.version" "Go version" }}
+{{ stencil.DefineString "name" "Project name" }}
+{{ stencil.DefineBool "lint" "Enable lint" }}
+{{ stencil.DefineList "services" "Services" }}
+{{ stencil.VarString "go.version" }} {{ stencil.VarString "name" }} {{ stencil.VarBool "lint" }} {{ stencil.VarList "services" }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}`,
+		"tpl": `{{ stencil.VarString "go.version" }} {{ stencil.VarString "name" }} {{ stencil.VarBool "lint" }} {{ stencil.VarList "services" }}`,
+	}
+
+	// answers files are read relative to the current directory
+	// rather than the workspace.
+	dir, err := ioutil.TempDir("", "stencil-test")
+	if err != nil {
+		t.Fatal("TempDir", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"answers.json": `{"go.version": "1.14", "name": "json", "lint": true, "services": ["api", "web"]}`,
+		"answers.yaml": "name: yaml\nlint: no\nservices: [db]\n",
+		"bad.json":     `{"lint": "maybe"}`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal("WriteFile", err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("Getwd", err)
+	}
+	defer os.Chdir(wd) //nolint: errcheck
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal("Chdir", err)
+	}
+
+	discard := discardLogger{}
+	main := func(args ...string) error {
+		s := stencil.New(discard, discard, &fakePrompter{"boo"}, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	err = main("pull", "recipe.md", "--no-input", "--var", "name=x")
+	if !errors.Is(err, stencil.ErrUnanswered) {
+		t.Fatal("Unexpected", err)
+	}
+	for _, s := range []string{"go.version: Go version", "lint: Enable lint", "services: Services"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Error("Missing", s, "in", err)
+		}
+	}
+	if strings.Contains(err.Error(), "name:") {
+		t.Error("Unexpected", err)
+	}
+	if _, ok := fs["out.txt"]; ok {
+		t.Error("Unexpected write with --no-input")
+	}
+	if _, ok := fs[".stencil/manifest.json"]; ok {
+		t.Error("Unexpected manifest with --no-input")
+	}
+
+	if err := main("pull", "recipe.md", "--no-input", "--answers", filepath.Join(dir, "answers.json")); err != nil {
+		t.Fatal("pull", err)
+	}
+	if fs["out.txt"] != "1.14 json true [api web]" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+
+	os.Setenv("STENCIL_VAR_GO_VERSION", "1.15")
+	defer os.Unsetenv("STENCIL_VAR_GO_VERSION")
+	if err := main("sync", "--no-input", "--answers", "answers.yaml", "--var", "name=var"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if fs["out.txt"] != "1.15 var false [db]" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+
+	if err := main("sync", "--answers", "bad.json"); err == nil || !strings.Contains(err.Error(), "bad.json lint") {
+		t.Error("Unexpected", err)
+	}
+	if err := main("sync", "--answers", "missing.json"); err == nil {
+		t.Error("Unexpected success with missing answers file")
+	}
+}
+
+func TestNoInputDefaults(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "go" "Go version" "default=v1.14.2" "validate=semver" }}
+{{ stencil.DefineString "name" "Name" }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}`,
+		"tpl": `{{ stencil.VarString "go" }} {{ stencil.VarString "name" }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(p stencil.Prompter, args ...string) error {
+		s := stencil.New(discard, discard, p, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	err := main(nil, "pull", "recipe.md", "--no-input")
+	if !errors.Is(err, stencil.ErrUnanswered) || strings.Contains(err.Error(), "go:") {
+		t.Fatal("Unexpected", err)
+	}
+	if err := main(nil, "pull", "recipe.md", "--no-input", "--var", "name=x"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if fs["out.txt"] != "v1.14.2 x" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+	if err := main(nil, "check"); err != nil {
+		t.Error("check", err)
+	}
+
+	// interactive syncs still ask for variables with a default.
+	fs[".stencil/manifest.json"] = `{"Pulls": [{"URL": "recipe.md"}], "Strings": {"name": "x"}}`
+	if code := stencil.ExitCode(main(nil, "check")); code != stencil.ExitOutOfDate {
+		t.Error("Unexpected check exit code", code)
+	}
+	if err := main(&fakePrompter{"v1.15.0"}, "sync"); err != nil || fs["out.txt"] != "v1.15.0 x" {
+		t.Error("Unexpected", fs["out.txt"], err)
+	}
+}
+
+func TestVarOptions(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "go" "Go version" "default=1.14.2" "validate=semver" "help=The Go toolchain" }}
+{{ stencil.DefineString "name" "Name" "pattern=[a-z]+" }}
+{{ stencil.DefineBool "lint" "Lint" "default=yes" }}
+{{ stencil.CopyFile "f" "out.txt" "tpl" }}
+{{ stencil.VarString "go" }} {{ stencil.VarString "name" }} {{ stencil.VarBool "lint" }}`,
+		"tpl": `{{ stencil.VarString "go" }} {{ stencil.VarString "name" }} {{ stencil.VarBool "lint" }}`,
+	}
+
+	discard := discardLogger{}
+	var out bytes.Buffer
+	main := func(input string, args ...string) error {
+		p := &stencil.ConsolePrompt{Stdin: strings.NewReader(input), Stdout: &out}
+		s := stencil.New(discard, discard, p, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	if err := main("abc\n\nBoo\nboo\n\n", "pull", "recipe.md"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if fs["out.txt"] != "1.14.2 boo true" {
+		t.Error("Unexpected", fs["out.txt"])
+	}
+	for _, s := range []string{"The Go toolchain\n", "Go version [1.14.2]? ", "not a semantic version", "must match [a-z]+"} {
+		if !strings.Contains(out.String(), s) {
+			t.Error("Missing", s, "in", out.String())
+		}
+	}
+
+	if err := main("", "sync", "--var", "go=latest"); err == nil {
+		t.Error("Unexpected success with invalid --var")
+	}
+
+	fs[".stencil/manifest.json"] = `{"Pulls": [{"URL": "recipe.md"}], "Strings": {"go": "1.15", "name": "B"}, "Bools": {"lint": true}}`
+	err := main("", "sync")
+	if err == nil || !strings.Contains(err.Error(), "invalid saved value of name") {
+		t.Error("Unexpected", err)
+	}
+	if err := main("", "sync", "--var", "name=b"); err != nil {
+		t.Error("Unexpected", err)
+	}
+
+	fs[".stencil/manifest.json"] = `{"Pulls": [{"URL": "recipe.md"}], "Strings": {"go": "", "name": "b"}, "Bools": {"lint": true}}`
+	if err := main("", "sync"); err != nil || fs["out.txt"] != "1.14.2 b true" {
+		t.Error("Unexpected saved empty answer", err, fs["out.txt"])
+	}
+}
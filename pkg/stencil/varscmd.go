@@ -0,0 +1,292 @@
+package stencil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// VarInfo describes a variable.  Set is false if the variable does
+// not have a saved (or global) value, in which case it is prompted
+// for on the next sync.  Source is where the value came from, such as
+// "prompt", "--var" or "global".  The values of secret variables are
+// never included.
+type VarInfo struct {
+	Name, Type string
+	Value      interface{} `json:",omitempty"`
+	Set        bool
+	Source     string   `json:",omitempty"`
+	Prompt     string   `json:",omitempty"`
+	Help       string   `json:",omitempty"`
+	Recipes    []string `json:",omitempty"`
+}
+
+// VarInfos returns all the variables defined by the last sync or
+// saved in the manifest, sorted by name.
+func (s *Stencil) VarInfos() ([]VarInfo, error) {
+	if err := s.Objects.LoadObjects(); err != nil {
+		return nil, err
+	}
+	s.Objects.restore()
+	return s.varInfos()
+}
+
+func (s *Stencil) varInfos() ([]VarInfo, error) {
+	infos := map[string]VarInfo{}
+	for name, def := range s.Definitions {
+		info := VarInfo{Name: name, Type: def.Type, Prompt: def.Prompt, Help: def.Help, Recipes: def.Recipes}
+		info.Value, info.Set = s.Objects.getVar(name, def.Type)
+		if info.Set {
+			info.Source = s.Objects.varSource(name)
+		} else if def.Type != TypeSecret {
+			val, ok, err := s.Vars.globalValue(name, def)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				info.Value, info.Set, info.Source = val, true, SourceGlobal
+			}
+		}
+		infos[name] = info
+	}
+
+	saved := func(typ, name string) {
+		if _, ok := infos[name]; !ok {
+			val, _ := s.Objects.getVar(name, typ)
+			infos[name] = VarInfo{Name: name, Type: typ, Value: val, Set: true, Source: s.Objects.varSource(name)}
+		}
+	}
+	for name := range s.Bools {
+		saved(TypeBool, name)
+	}
+	for name := range s.Strings {
+		saved(TypeString, name)
+	}
+	for name := range s.Ints {
+		saved(TypeInt, name)
+	}
+	for name := range s.Lists {
+		saved(TypeList, name)
+	}
+	for name := range s.Maps {
+		saved(TypeMap, name)
+	}
+
+	result := make([]VarInfo, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Variables implements the vars command:
+//
+//	list             -- list all variables
+//	get name         -- print the value of a variable
+//	set name=value   -- change the value of a variable
+//	unset name       -- remove the value so it is prompted for again,
+//	                    starting out with the removed value
+//
+// Values are checked against the definition recorded by the last
+// sync.  The list and get output is JSON with --json.  With --global,
+// all of them work on the values shared by all workspaces instead (see
+// GlobalVars).
+func (s *Stencil) Variables(cmd, arg string) error {
+	if err := s.Objects.LoadObjects(); err != nil {
+		return s.Errorf("LoadObjects %v\n", err)
+	}
+	s.Objects.restore()
+	if s.global {
+		return s.globalVariables(cmd, arg)
+	}
+
+	switch cmd {
+	case "", "list":
+		infos, err := s.varInfos()
+		if err != nil {
+			return s.Errorf("vars %v\n", err)
+		}
+		return s.printVars(infos)
+	case "get":
+		if def, ok := s.Definitions[arg]; ok && def.Type == TypeSecret {
+			return s.getSecret(arg)
+		}
+		infos, err := s.varInfos()
+		if err != nil {
+			return s.Errorf("vars %v\n", err)
+		}
+		for _, info := range infos {
+			if info.Name == arg && info.Set {
+				if s.json {
+					return s.printJSON(info.Value)
+				}
+				_, err := fmt.Fprintln(s.Stdout, formatVar(info.Value))
+				return err
+			}
+		}
+		return s.Errorf("vars %v\n", errors.New("no value for "+arg))
+	case "set":
+		parts := strings.SplitN(arg, "=", 2)
+		def, ok := s.Definitions[parts[0]]
+		if len(parts) != 2 || !ok {
+			return s.Errorf("vars %v\n", errors.New("set requires name=value for a defined variable"))
+		}
+		val, err := def.Parse(parts[1])
+		if err != nil {
+			return s.Errorf("vars %s: %v\n", parts[0], err)
+		}
+		if def.Type == TypeSecret {
+			return s.setSecret(parts[0], parts[1])
+		}
+		s.Objects.unsetVar(parts[0])
+		s.Objects.setVar(parts[0], val, SourceSet)
+	case "unset":
+		if def, ok := s.Definitions[arg]; ok && def.Type == TypeSecret {
+			return s.setSecret(arg, "")
+		}
+		s.Objects.forgetVar(arg)
+	default:
+		return s.Errorf("%v", errors.New("unknown vars command: "+cmd))
+	}
+	return s.SaveObjects()
+}
+
+// globalVariables implements the vars command with --global.
+func (s *Stencil) globalVariables(cmd, arg string) error {
+	if s.Globals == nil {
+		return s.Errorf("vars %v\n", errors.New("no global values"))
+	}
+
+	var err error
+	switch cmd {
+	case "", "list":
+		return s.printGlobals()
+	case "get":
+		return s.printGlobal(arg)
+	case "set":
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return s.Errorf("vars %v\n", errors.New("set requires name=value"))
+		}
+		if def, ok := s.Definitions[parts[0]]; ok && def.Type == TypeSecret {
+			return s.Errorf("vars %v\n", errors.New("secrets cannot be global: "+parts[0]))
+		} else if ok {
+			if _, err := def.Parse(parts[1]); err != nil {
+				return s.Errorf("vars %s: %v\n", parts[0], err)
+			}
+		}
+		err = s.Globals.Set(parts[0], parts[1])
+	case "unset":
+		err = s.Globals.Delete(arg)
+	default:
+		err = errors.New("unknown vars command: " + cmd)
+	}
+	if err != nil {
+		return s.Errorf("vars %v\n", err)
+	}
+	return nil
+}
+
+func (s *Stencil) printGlobals() error {
+	values, err := s.Globals.All()
+	if err != nil {
+		return s.Errorf("vars %v\n", err)
+	}
+
+	infos := []VarInfo{}
+	for name, value := range values {
+		info := VarInfo{Name: name, Value: value, Set: true, Source: SourceGlobal}
+		if def, ok := s.Definitions[name]; ok {
+			info.Type, info.Prompt = def.Type, def.Prompt
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return s.printVars(infos)
+}
+
+func (s *Stencil) printGlobal(name string) error {
+	raw, ok, err := s.Globals.Get(name)
+	if err == nil && !ok {
+		err = errors.New("no global value for " + name)
+	}
+	if err != nil {
+		return s.Errorf("vars %v\n", err)
+	}
+	if !s.json {
+		_, err = fmt.Fprintln(s.Stdout, raw)
+		return err
+	}
+	if def, ok := s.Definitions[name]; ok {
+		if val, err := def.Parse(raw); err == nil {
+			return s.printJSON(val)
+		}
+	}
+	return s.printJSON(raw)
+}
+
+func (s *Stencil) getSecret(name string) error {
+	if s.Secrets == nil {
+		return s.Errorf("vars %v\n", errors.New("no secret store"))
+	}
+	val, ok, err := s.Secrets.Get(name)
+	if err == nil && !ok {
+		err = errors.New("no value for " + name)
+	}
+	if err != nil {
+		return s.Errorf("vars %v\n", err)
+	}
+	if s.json {
+		return s.printJSON(val)
+	}
+	_, err = fmt.Fprintln(s.Stdout, val)
+	return err
+}
+
+// setSecret saves a secret or deletes it if the value is empty.
+func (s *Stencil) setSecret(name, value string) error {
+	if s.Secrets == nil {
+		return s.Errorf("vars %v\n", errors.New("no secret store"))
+	}
+	err := s.Secrets.Delete(name)
+	if value != "" && err == nil {
+		err = s.Secrets.Set(name, value)
+	}
+	if err != nil {
+		return s.Errorf("vars %v\n", err)
+	}
+	return nil
+}
+
+func (s *Stencil) printVars(infos []VarInfo) error {
+	if s.json {
+		return s.printJSON(infos)
+	}
+
+	w := tabwriter.NewWriter(s.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tVALUE\tSOURCE\tPROMPT\tRECIPES")
+	for _, info := range infos {
+		value := "(unset)"
+		if info.Set {
+			value = formatVar(info.Value)
+		}
+		if info.Type == TypeSecret {
+			value = "(secret)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Name, info.Type, value, info.Source, info.Prompt, strings.Join(info.Recipes, ", "))
+	}
+	return w.Flush()
+}
+
+func (s *Stencil) printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return s.Errorf("json %v\n", err)
+	}
+	_, err = s.Stdout.Write(append(data, '\n'))
+	return err
+}
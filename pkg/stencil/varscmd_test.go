@@ -0,0 +1,125 @@
+package stencil_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/argots/stencil/pkg/stencil"
+)
+
+func TestVarsCommand(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "name" "Name" }}
+{{ stencil.DefineInt "replicas" "Replicas" 1 10 }}
+{{ stencil.VarString "name" }} {{ stencil.VarInt "replicas" }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		s := stencil.New(discard, discard, &fakePrompter{"prompted"}, fs)
+		s.Stdout = &out
+		args = append([]string{"stencil"}, args...)
+		err := s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+		return out.String(), err
+	}
+
+	if _, err := main("pull", "recipe.md", "--var", "name=boo", "--var", "replicas=3"); err != nil {
+		t.Fatal("pull", err)
+	}
+
+	out, err := main("vars", "--json")
+	if err != nil {
+		t.Fatal("vars", err)
+	}
+	var infos []stencil.VarInfo
+	if err := json.Unmarshal([]byte(out), &infos); err != nil {
+		t.Fatal("Unmarshal", err, out)
+	}
+	expected := []stencil.VarInfo{
+		{Name: "name", Type: "string", Value: "boo", Set: true, Source: "--var", Prompt: "Name", Recipes: []string{"recipe.md"}},
+		{Name: "replicas", Type: "int", Value: 3.0, Set: true, Source: "--var", Prompt: "Replicas", Recipes: []string{"recipe.md"}},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Error("Unexpected", out)
+	}
+
+	if out, err := main("vars", "list"); err != nil || !strings.Contains(out, "replicas  int     3") {
+		t.Error("Unexpected", out, err)
+	}
+
+	if _, err := main("vars", "set", "replicas=20"); err == nil {
+		t.Error("Unexpected success setting an out of range value")
+	}
+	if _, err := main("vars", "set", "replicas=5"); err != nil {
+		t.Error("set", err)
+	}
+	if out, err := main("vars", "get", "replicas"); err != nil || out != "5\n" {
+		t.Error("Unexpected", out, err)
+	}
+
+	if _, err := main("vars", "unset", "name"); err != nil {
+		t.Error("unset", err)
+	}
+	if _, err := main("vars", "get", "name"); err == nil {
+		t.Error("Unexpected success getting an unset value")
+	}
+	if _, err := main("sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if out, err := main("vars", "get", "name"); err != nil || out != "prompted\n" {
+		t.Error("Unexpected", out, err)
+	}
+}
+
+func TestVarsUnsetPrevious(t *testing.T) {
+	fs := memFS{
+		"recipe.md": `{{ stencil.DefineString "name" "Name" }}
+{{ stencil.DefineString "other" "Other" }}
+{{ stencil.VarString "name" }} {{ stencil.VarString "other" }}`,
+	}
+
+	discard := discardLogger{}
+	main := func(p stencil.Prompter, args ...string) error {
+		s := stencil.New(discard, discard, p, fs)
+		args = append([]string{"stencil"}, args...)
+		return s.Main(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	}
+
+	if err := main(nil, "pull", "recipe.md", "--var", "name=old", "--var", "other=x"); err != nil {
+		t.Fatal("pull", err)
+	}
+	if err := main(nil, "vars", "unset", "name"); err != nil {
+		t.Fatal("unset", err)
+	}
+	if err := main(nil, "vars", "unset", "other"); err != nil {
+		t.Fatal("unset", err)
+	}
+
+	p := &previousPrompter{previous: map[string]string{}}
+	if err := main(p, "sync"); err != nil {
+		t.Fatal("sync", err)
+	}
+	if expected := map[string]string{"name": "old", "other": "x"}; !reflect.DeepEqual(p.previous, expected) {
+		t.Error("Unexpected previous answers", p.previous)
+	}
+	if strings.Contains(fs[".stencil/objects.json"], `"Previous"`) {
+		t.Error("Previous answers kept after answering", fs[".stencil/objects.json"])
+	}
+}
+
+// previousPrompter records the previous answer of every question and
+// answers with it.
+type previousPrompter struct {
+	fakePrompter
+	previous map[string]string
+}
+
+func (p *previousPrompter) Ask(q *stencil.Question) (string, error) {
+	p.previous[q.Name] = q.Previous
+	return q.Previous, nil
+}
@@ -18,11 +18,15 @@ func main() {
 	verbose := log.New(os.Stdout, "stencil: ", 0)
 	errorl := log.New(os.Stderr, "stencil: ", 0)
 	fs := &stencil.FS{BaseDir: baseDir, Verbose: verbose, Errorl: errorl}
-	p := &stencil.ConsolePrompt{Stdin: os.Stdin, Stdout: os.Stdout}
+	p := stencil.NewPrompt(os.Stdin, os.Stdout)
 
 	s := stencil.New(verbose, errorl, p, fs)
+	if s.Secrets, err = stencil.DefaultSecretStore(baseDir, p); err != nil {
+		errorl.Printf("secrets %v\n", err)
+	}
+	s.Globals = stencil.DefaultGlobalVars()
 	if err := s.Main(flags, os.Args); err != nil {
 		errorl.Printf("error %v\n", err)
-		os.Exit(1)
+		os.Exit(stencil.ExitCode(err))
 	}
 }